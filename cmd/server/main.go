@@ -12,6 +12,7 @@ import (
 	"github.com/joho/godotenv"
 
 	"github.com/avivbaron/ads-analyzer/internal/analysis"
+	"github.com/avivbaron/ads-analyzer/internal/breaker"
 	"github.com/avivbaron/ads-analyzer/internal/cache"
 	"github.com/avivbaron/ads-analyzer/internal/config"
 	"github.com/avivbaron/ads-analyzer/internal/httpserver"
@@ -60,14 +61,81 @@ func main() {
 	}
 	defer closeCache()
 
-	fetcher := analysis.NewHTTPFetcher(cfg.FetchTimeout, cfg.HTTPFallback)
-	svc := analysis.NewService(c, fetcher, cfg.CacheTTL)
+	var brk *breaker.Breaker
+	if cfg.BreakerEnabled {
+		// stored in the shared cache, so replicas on Redis see the same circuits;
+		// transitions between replicas are best-effort (see package breaker)
+		brk = breaker.New(c, breaker.Options{
+			Threshold:    cfg.BreakerThreshold,
+			Cooldown:     cfg.BreakerCooldown,
+			ProbeTimeout: cfg.FetchDeadline, // a probe is one fetch
+		})
+	}
+
+	// shared by the ads.txt and sellers.json fetchers
+	outbound := ratelimit.NewOutbound(ratelimit.OutboundOptions{
+		PerHost:     cfg.FetchMaxPerHost,
+		DomainRPS:   cfg.FetchDomainRPS,
+		DomainBurst: cfg.FetchDomainBurst,
+		Global:      cfg.FetchMaxInFlight,
+	})
+	defer outbound.Close()
+
+	fetchOpts := analysis.FetcherOptions{
+		Timeout:      cfg.FetchTimeout,
+		Deadline:     cfg.FetchDeadline,
+		HTTPFallback: cfg.HTTPFallback,
+		Mode:         analysis.FetchMode(cfg.FetchMode),
+		HedgeDelay:   cfg.HedgeDelay,
+		HostVariants: analysis.HostVariants(cfg.HostVariants),
+		MaxBytes:     cfg.FetchMaxBytes,
+		AllowCIDRs:   cfg.FetchAllowCIDRs,
+		Retry: analysis.RetryPolicy{
+			MaxAttempts: cfg.FetchRetryAttempts,
+			BaseDelay:   cfg.FetchRetryBaseDelay,
+			MaxDelay:    cfg.FetchRetryMaxDelay,
+		},
+		Breaker:  brk,
+		Outbound: outbound,
+	}
+	fetcher := analysis.NewHTTPFetcherWithOptions(fetchOpts)
+	sellersOpts := fetchOpts
+	sellersOpts.MaxBytes = cfg.SellersMaxBytes
+	sellersFetcher := analysis.NewHTTPSellersFetcherWithOptions(sellersOpts)
+	sellers := analysis.NewSellersService(c, sellersFetcher, cfg.SellersTTL)
+	var aliases *analysis.Aliases
+	if cfg.AliasFile != "" {
+		if aliases, err = analysis.LoadAliases(cfg.AliasFile); err != nil {
+			logger.Fatal().Err(err).Msg("alias registry load failed")
+		}
+	}
+	svc := analysis.NewServiceWithOptions(c, fetcher, analysis.ServiceOptions{
+		TTL:               cfg.CacheTTL,
+		MaxSubdomains:     cfg.SubdomainMaxFanout,
+		MaxSubdomainDepth: cfg.SubdomainMaxDepth,
+		Sellers:           sellers,
+		SupplyChain: analysis.SupplyChainOptions{
+			MaxDepth: cfg.SupplyChainMaxDepth,
+			MaxNodes: cfg.SupplyChainMaxNodes,
+			Workers:  cfg.SupplyChainWorkers,
+		},
+		Aliases:          aliases,
+		RevalidateWindow: cfg.RevalidateWin,
+		MergeWWW:         cfg.HostVariants == string(analysis.HostVariantsWWW),
+	})
 
 	addr := ":" + cfg.Port
 	serverDeps := httpserver.Deps{
 		Cache:        c,
 		Analyzer:     svc,
+		Validator:    svc,
+		Sellers:      sellers,
+		SChain:       svc,
 		BatchWorkers: cfg.BatchWorkers,
+		AdminToken:   cfg.AdminToken,
+	}
+	if brk != nil {
+		serverDeps.Breakers = brk
 	}
 	srv := httpserver.New(addr, logger, limiter, serverDeps, cfg.MetricsEnabled)
 
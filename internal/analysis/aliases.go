@@ -0,0 +1,105 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+
+	"github.com/avivbaron/ads-analyzer/internal/models"
+	"github.com/avivbaron/ads-analyzer/internal/util"
+)
+
+// Aliases maps known exchange domains to a canonical SSP name.
+// A nil *Aliases is valid and knows no aliases.
+type Aliases struct {
+	byDomain map[string]string
+}
+
+// NewAliases builds a registry from name -> domains, e.g.
+// {"Google": ["google.com", "doubleclick.net"]}.
+func NewAliases(groups map[string][]string) *Aliases {
+	a := &Aliases{byDomain: make(map[string]string)}
+	for name, domains := range groups {
+		for _, d := range domains {
+			a.byDomain[strings.ToLower(strings.TrimSpace(d))] = name
+		}
+	}
+	return a
+}
+
+// LoadAliases reads a name -> domains registry from a JSON file, or YAML
+// when the extension is .yaml/.yml.
+func LoadAliases(path string) (*Aliases, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups map[string][]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &groups)
+	default:
+		err = json.Unmarshal(b, &groups)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("alias file %s: %w", path, err)
+	}
+	return NewAliases(groups), nil
+}
+
+// Lookup returns the canonical name for domain, matching the exact domain
+// first and then its registrable domain.
+func (a *Aliases) Lookup(domain string) (string, bool) {
+	if a == nil {
+		return "", false
+	}
+	if n, ok := a.byDomain[domain]; ok {
+		return n, true
+	}
+	n, ok := a.byDomain[util.RegistrableDomain(domain)]
+	return n, ok
+}
+
+// groupAdvertisers folds per-domain counts into groups keyed by registrable
+// domain or, with models.GroupAlias, by alias name when one is known.
+func groupAdvertisers(list []models.AdvertiserCount, mode models.Grouping, aliases *Aliases) []models.AdvertiserGroup {
+	byName := make(map[string]*models.AdvertiserGroup)
+	for _, ac := range list {
+		name := ac.RegistrableDomain
+		if name == "" {
+			name = util.RegistrableDomain(ac.Domain)
+		}
+		if mode == models.GroupAlias {
+			if n, ok := aliases.Lookup(ac.Domain); ok {
+				name = n
+			}
+		}
+		g, ok := byName[name]
+		if !ok {
+			g = &models.AdvertiserGroup{Name: name}
+			byName[name] = g
+		}
+		g.Count += ac.Count
+		g.Direct += ac.Direct
+		g.Reseller += ac.Reseller
+		g.Domains = append(g.Domains, ac.Domain)
+	}
+
+	out := make([]models.AdvertiserGroup, 0, len(byName))
+	for _, g := range byName {
+		sort.Strings(g.Domains)
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
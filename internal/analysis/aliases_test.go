@@ -0,0 +1,60 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avivbaron/ads-analyzer/internal/models"
+)
+
+// TestLoadAliases_JSONAndYAML ensures both registry formats load and that
+// lookups match exact domains and registrable domains.
+// PASS: ads.google.com and doubleclick.net resolve to "Google" from both files.
+// FAIL: load error or missing lookup.
+func TestLoadAliases_JSONAndYAML(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"aliases.json": `{"Google": ["google.com", "DoubleClick.net"]}`,
+		"aliases.yaml": "Google:\n  - google.com\n  - doubleclick.net\n",
+	}
+	for name, body := range files {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		a, err := LoadAliases(p)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, d := range []string{"ads.google.com", "doubleclick.net"} {
+			if n, ok := a.Lookup(d); !ok || n != "Google" {
+				t.Fatalf("%s: lookup %s = %q,%v", name, d, n, ok)
+			}
+		}
+	}
+	var none *Aliases
+	if _, ok := none.Lookup("google.com"); ok {
+		t.Fatalf("nil registry should know nothing")
+	}
+}
+
+// TestGroupAdvertisers verifies grouping by registrable domain and by alias.
+// PASS: registrable grouping merges ads.google.com into google.com; alias grouping
+// also folds doubleclick.net into "Google".
+// FAIL: wrong group names or counts.
+func TestGroupAdvertisers(t *testing.T) {
+	list, _ := advertiserCounts(ParseAdsTxtRecords([]byte(`google.com, pub-1, DIRECT
+ads.google.com, pub-1, RESELLER
+doubleclick.net, 1, DIRECT
+appnexus.com, 2, RESELLER
+`)))
+	reg := groupAdvertisers(list, models.GroupRegistrable, nil)
+	if len(reg) != 3 || reg[0].Name != "google.com" || reg[0].Count != 2 || reg[0].Direct != 1 || reg[0].Reseller != 1 {
+		t.Fatalf("bad registrable groups: %#v", reg)
+	}
+	al := groupAdvertisers(list, models.GroupAlias, NewAliases(map[string][]string{"Google": {"google.com", "doubleclick.net"}}))
+	if len(al) != 2 || al[0].Name != "Google" || al[0].Count != 3 || len(al[0].Domains) != 3 {
+		t.Fatalf("bad alias groups: %#v", al)
+	}
+}
@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// EncodingUTF8 is the encoding reported when the input needed no decoding.
+const EncodingUTF8 = "utf-8"
+
+// sniffWindow is how much of the input is checked for valid UTF-8 when
+// neither a BOM nor a charset says what it is.
+const sniffWindow = 64 * 1024
+
+var boms = []struct {
+	bom  []byte
+	name string
+	enc  encoding.Encoding
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, "utf-8 (bom)", unicode.UTF8BOM},
+	{[]byte{0xFF, 0xFE}, "utf-16le (bom)", unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)},
+	{[]byte{0xFE, 0xFF}, "utf-16be (bom)", unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)},
+}
+
+// decodeText wraps r so it yields UTF-8 and names the source encoding.
+// A byte-order mark wins, then the charset parameter of contentType, then
+// a check of the first 64KB: invalid UTF-8 is taken as Windows-1252, the
+// usual superset of Latin-1.
+func decodeText(r io.Reader, contentType string) (io.Reader, string) {
+	br := bufio.NewReaderSize(r, sniffWindow)
+	head, _ := br.Peek(3)
+	for _, b := range boms {
+		if bytes.HasPrefix(head, b.bom) {
+			return transform.NewReader(br, b.enc.NewDecoder()), b.name
+		}
+	}
+
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		if enc, err := htmlindex.Get(params["charset"]); err == nil {
+			name, _ := htmlindex.Name(enc)
+			if name == EncodingUTF8 {
+				return br, EncodingUTF8
+			}
+			return transform.NewReader(br, enc.NewDecoder()), name
+		}
+	}
+
+	window, _ := br.Peek(sniffWindow)
+	if !validUTF8Prefix(window) {
+		return transform.NewReader(br, charmap.Windows1252.NewDecoder()), "windows-1252 (guessed)"
+	}
+	return br, EncodingUTF8
+}
+
+// validUTF8Prefix reports whether b is valid UTF-8, allowing it to end in
+// the middle of a multi-byte sequence (b is a window into a longer stream).
+func validUTF8Prefix(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(b) && len(b) < utf8.UTFMax
+		}
+		b = b[size:]
+	}
+	return true
+}
+
+// isUTF16Charset reports whether contentType declares a UTF-16 charset.
+func isUTF16Charset(contentType string) bool {
+	_, params, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.HasPrefix(strings.ToLower(params["charset"]), "utf-16")
+}
@@ -0,0 +1,48 @@
+package analysis
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/avivbaron/ads-analyzer/internal/models"
+)
+
+// TestParseWithContentType_Encodings checks BOM, charset and guessed decoding.
+// PASS: every input yields google.com as the first record, the expected
+// summary encoding, and an info diagnostic unless the file is plain UTF-8.
+// FAIL: BOM left in the domain, wrong encoding name or missing diagnostic.
+func TestParseWithContentType_Encodings(t *testing.T) {
+	const text = "# Éditions Müller\ngoogle.com, pub-1, DIRECT\n"
+	utf16le, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte(text))
+	utf16be, _ := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte(text))
+	latin1 := []byte("# \xc9ditions M\xfcller\ngoogle.com, pub-1, DIRECT\n")
+
+	cases := []struct {
+		name, ct string
+		body     []byte
+		want     string
+	}{
+		{"plain", "text/plain", []byte(text), EncodingUTF8},
+		{"utf-8 bom", "text/plain", append([]byte{0xEF, 0xBB, 0xBF}, text...), "utf-8 (bom)"},
+		{"utf-16le bom", "text/plain", utf16le, "utf-16le (bom)"},
+		{"utf-16be charset", "text/plain; charset=UTF-16BE", utf16be, "utf-16be"},
+		{"latin-1 charset", "text/plain; charset=ISO-8859-1", latin1, "windows-1252"},
+		{"latin-1 guessed", "text/plain", latin1, "windows-1252 (guessed)"},
+	}
+	for _, c := range cases {
+		res := ParseWithContentType(bytes.NewReader(c.body), c.ct)
+		if len(res.Records) != 1 || res.Records[0].Domain != "google.com" {
+			t.Fatalf("%s: records %#v", c.name, res.Records)
+		}
+		if res.Summary.Encoding != c.want {
+			t.Fatalf("%s: encoding %q want %q", c.name, res.Summary.Encoding, c.want)
+		}
+		hasDiag := len(res.Diagnostics) == 1 && res.Diagnostics[0].Code == CodeEncoding &&
+			res.Diagnostics[0].Severity == models.SeverityInfo
+		if hasDiag != (c.want != EncodingUTF8) || res.Summary.Warnings != 0 || res.Summary.Errors != 0 {
+			t.Fatalf("%s: diagnostics %#v summary %#v", c.name, res.Diagnostics, res.Summary)
+		}
+	}
+}
@@ -1,84 +1,518 @@
 package analysis
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 	"time"
 
+	"github.com/avivbaron/ads-analyzer/internal/breaker"
 	"github.com/avivbaron/ads-analyzer/internal/metrics"
+	"github.com/avivbaron/ads-analyzer/internal/models"
+	"github.com/avivbaron/ads-analyzer/internal/ratelimit"
+	"github.com/avivbaron/ads-analyzer/internal/util"
 )
 
+// Fetcher downloads an ads.txt-style file.
 type Fetcher interface {
-	GetAdsTxt(ctx context.Context, domain string) ([]byte, error)
+	GetAdsTxt(ctx context.Context, req FetchRequest) (*FetchResult, error)
+}
+
+// FetchRequest names the file to download. When ETag or LastModified is
+// set the request is conditional and may come back NotModified.
+type FetchRequest struct {
+	Domain       string
+	Kind         models.FileKind // ads.txt or app-ads.txt
+	ETag         string          // sent as If-None-Match
+	LastModified string          // sent as If-Modified-Since
+}
+
+// FetchResult is a downloaded file and how it was retrieved.
+type FetchResult struct {
+	Body        []byte
+	Info        models.FetchInfo
+	NotModified bool // origin answered 304 to a conditional request; Body is empty
+}
+
+// SellersFetcher downloads an ad system's /sellers.json.
+type SellersFetcher interface {
+	GetSellersJSON(ctx context.Context, domain string) ([]byte, error)
+}
+
+// FetcherOptions configures the HTTP fetchers.
+type FetcherOptions struct {
+	Timeout      time.Duration // per request attempt
+	Deadline     time.Duration // one whole fetch: retries, schemes, host variants; 0 => caller's context only
+	HTTPFallback bool          // allow http:// fallback if https fails; false => FetchHTTPSOnly
+	Mode         FetchMode     // how https and the http fallback are tried; "" => FetchSequential
+	HedgeDelay   time.Duration // FetchHedged: head start of https; 0 => 1s
+	HostVariants HostVariants  // alternative hosts tried for ads.txt; "" => HostVariantsNone
+	MaxBytes     int64         // body size cap; 0 => unlimited
+	// AllowCIDRs exempts destinations from the SSRF guard, which otherwise
+	// refuses loopback, private, link-local, multicast and metadata addresses.
+	AllowCIDRs []netip.Prefix
+	Retry      RetryPolicy         // retries of transient failures per URL; zero => none
+	Breaker    *breaker.Breaker    // per-host circuit breaker; nil => off
+	Outbound   *ratelimit.Outbound // per-host/per-domain/global politeness limits; nil => off
 }
 
 type httpFetcher struct {
 	client       *http.Client
-	httpFallback bool
+	timeout      time.Duration
+	deadline     time.Duration
+	mode         FetchMode
+	hedgeDelay   time.Duration
+	hostVariants HostVariants
+	maxBytes     int64 // 0 => unlimited
+	retry        RetryPolicy
+	breaker      *breaker.Breaker
+	outbound     *ratelimit.Outbound
 }
 
 func NewHTTPFetcher(timeout time.Duration, httpFallback bool) Fetcher {
+	return NewHTTPFetcherWithOptions(FetcherOptions{Timeout: timeout, HTTPFallback: httpFallback})
+}
+
+func NewHTTPFetcherWithOptions(opt FetcherOptions) Fetcher {
+	return newHTTPFetcher(opt)
+}
+
+// NewHTTPSellersFetcher returns a sellers.json fetcher sharing the ads.txt
+// fetcher's timeout, fallback and redirect behavior. Bodies larger than
+// maxBytes (0 => unlimited) fail with *TooLargeError.
+func NewHTTPSellersFetcher(timeout time.Duration, httpFallback bool, maxBytes int64) SellersFetcher {
+	return NewHTTPSellersFetcherWithOptions(FetcherOptions{Timeout: timeout, HTTPFallback: httpFallback, MaxBytes: maxBytes})
+}
+
+func NewHTTPSellersFetcherWithOptions(opt FetcherOptions) SellersFetcher {
+	return newHTTPFetcher(opt)
+}
+
+// newHTTPFetcher builds a client whose dialer vets every resolved address,
+// including those of redirect hops. Proxies are disabled because a proxy
+// would connect on our behalf, past the guard.
+func newHTTPFetcher(opt FetcherOptions) *httpFetcher {
+	dialer := &net.Dialer{
+		Timeout:   opt.Timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   dialGuard(opt.AllowCIDRs),
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil
+	tr.DialContext = dialer.DialContext
 	c := &http.Client{
-		Timeout: timeout,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 5 {
-				return errors.New("stopped after 5 redirects")
-			}
-			return nil
-		},
+		Timeout:       opt.Timeout,
+		Transport:     tr,
+		CheckRedirect: checkRedirect,
+	}
+	mode := opt.Mode
+	if mode == "" {
+		mode = FetchSequential
+	}
+	if !opt.HTTPFallback {
+		mode = FetchHTTPSOnly
+	}
+	if opt.HedgeDelay <= 0 {
+		opt.HedgeDelay = time.Second
+	}
+	return &httpFetcher{client: c, timeout: opt.Timeout, deadline: opt.Deadline, mode: mode, hedgeDelay: opt.HedgeDelay, hostVariants: opt.HostVariants, maxBytes: opt.MaxBytes, retry: opt.Retry.withDefaults(), breaker: opt.Breaker, outbound: opt.Outbound}
+}
+
+// HostVariants selects the alternative hosts tried for ads.txt.
+type HostVariants string
+
+const (
+	// HostVariantsNone only tries the requested domain.
+	HostVariantsNone HostVariants = "none"
+	// HostVariantsWWW also tries www.<domain> when the bare domain has no
+	// file, or the bare domain first when www.<domain> was requested.
+	HostVariantsWWW HostVariants = "www"
+)
+
+// GetAdsTxt downloads the file from freq.Domain or, when that host has no
+// file, its host variants, and records the host that served it. Validators
+// in freq belong to freq.Domain and are not sent to its variants.
+func (f *httpFetcher) GetAdsTxt(ctx context.Context, freq FetchRequest) (*FetchResult, error) {
+	ctx, cancel := f.withDeadline(ctx)
+	defer cancel()
+
+	hosts := []string{freq.Domain}
+	if v, ok := util.WWWVariant(freq.Domain); ok && f.hostVariants == HostVariantsWWW {
+		hosts = append(hosts, v)
+	}
+
+	var lastErr error
+	for i, host := range hosts {
+		hreq := freq
+		hreq.Domain = host
+		if i > 0 {
+			hreq.ETag, hreq.LastModified = "", ""
+		}
+		res, err := f.getAdsTxt(ctx, hreq)
+		if err == nil {
+			res.Info.Host = host
+			return res, nil
+		}
+		if !noFileAt(err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// noFileAt reports whether err means the host does not serve the file, so
+// its host variant is worth trying: not found, a soft-404 page or a name that
+// does not resolve. An open circuit is not one of them: it fails fast with
+// its *breaker.OpenError like any other failure of the host.
+func noFileAt(err error) bool {
+	var (
+		se  *StatusError
+		ic  *InvalidContentError
+		dns *net.DNSError
+	)
+	switch {
+	case errors.As(err, &se):
+		return se.Code == http.StatusNotFound || se.Code == http.StatusGone
+	case errors.As(err, &dns):
+		return dns.IsNotFound
+	}
+	return errors.As(err, &ic)
+}
+
+// getAdsTxt downloads the file from one host. 200 responses that are not
+// text (soft-404 pages, binaries) fail that scheme's attempt with
+// *InvalidContentError, so the other scheme is still tried.
+func (f *httpFetcher) getAdsTxt(ctx context.Context, freq FetchRequest) (*FetchResult, error) {
+	return f.get(ctx, freq, freq.Kind.Path(), true)
+}
+
+func (f *httpFetcher) GetSellersJSON(ctx context.Context, domain string) ([]byte, error) {
+	ctx, cancel := f.withDeadline(ctx)
+	defer cancel()
+	res, err := f.get(ctx, FetchRequest{Domain: domain}, "/sellers.json", false)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// errDeadline is the cancellation cause when a fetch runs out of f.deadline,
+// as opposed to the caller giving up. It still matches
+// context.DeadlineExceeded, so callers report a timeout.
+var errDeadline = fmt.Errorf("fetch deadline: %w", context.DeadlineExceeded)
+
+// withDeadline bounds one fetch by f.deadline.
+func (f *httpFetcher) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.deadline <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, f.deadline, errDeadline)
+}
+
+// callerGone reports whether ctx ended for a reason other than the fetch
+// deadline, which says nothing about the origin.
+func callerGone(ctx context.Context) bool {
+	return ctx.Err() != nil && !errors.Is(context.Cause(ctx), errDeadline)
+}
+
+// get downloads https://freq.Domain+path, falling back to http:// when
+// enabled, conditionally when freq carries validators. With text set (ads.txt
+// style files) bodies above f.maxBytes are cut at the last full line, so the
+// file stays usable, and non-text bodies fail with *InvalidContentError;
+// otherwise oversized bodies fail with *TooLargeError. While the
+// domain's circuit is open it fails fast with *breaker.OpenError.
+func (f *httpFetcher) get(ctx context.Context, freq FetchRequest, path string, text bool) (*FetchResult, error) {
+	if f.breaker == nil {
+		return f.getSchemes(ctx, freq, path, text)
+	}
+	if err := f.breaker.Allow(ctx, freq.Domain); err != nil {
+		return nil, err
+	}
+	res, err := f.getSchemes(ctx, freq, path, text)
+	switch {
+	case callerGone(ctx):
+		// says nothing about the origin; an expired fetch deadline does
+	case originFailure(err):
+		f.breaker.Failure(ctx, freq.Domain)
+	default:
+		f.breaker.Success(ctx, freq.Domain)
+	}
+	return res, err
+}
+
+// originFailure reports whether err means the origin is down or overloaded,
+// as opposed to a definite answer such as a 404 or a policy refusal.
+func originFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= 500 || retryableStatus[se.Code]
 	}
-	return &httpFetcher{client: c, httpFallback: httpFallback}
+	var (
+		be *BlockedError
+		re *RedirectError
+		tl *TooLargeError
+		ic *InvalidContentError
+	)
+	return !errors.As(err, &be) && !errors.As(err, &re) && !errors.As(err, &tl) && !errors.As(err, &ic)
 }
 
-func (f *httpFetcher) GetAdsTxt(ctx context.Context, domain string) ([]byte, error) {
-	urls := []string{"https://" + domain + "/ads.txt"}
-	if f.httpFallback {
-		urls = append(urls, "http://"+domain+"/ads.txt")
+// getSchemes tries the https:// and, unless https-only, http:// URLs
+// according to f.mode, and records the mode in the result.
+func (f *httpFetcher) getSchemes(ctx context.Context, freq FetchRequest, path string, text bool) (*FetchResult, error) {
+	urls := []string{"https://" + freq.Domain + path}
+	if f.mode != FetchHTTPSOnly {
+		urls = append(urls, "http://"+freq.Domain+path)
 	}
 
+	var (
+		res *FetchResult
+		err error
+	)
+	if f.mode == FetchHedged {
+		res, err = f.getHedged(ctx, urls, freq, text)
+	} else {
+		res, err = f.getSequential(ctx, urls, freq, text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Info.Mode = string(f.mode)
+	return res, nil
+}
+
+// getSequential tries each URL in turn.
+func (f *httpFetcher) getSequential(ctx context.Context, urls []string, freq FetchRequest, text bool) (*FetchResult, error) {
 	var lastErr error
 
-	for _, u := range urls {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	for i, u := range urls {
+		res, err := f.getURL(ctx, u, freq, text)
+		if err == nil {
+			res.Info.Fallback = i > 0
+			return res, nil
+		}
+		var be *BlockedError
+		var tl *TooLargeError
+		if errors.As(err, &be) || errors.As(err, &tl) {
+			return nil, err // the other scheme reaches the same host and file
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// getURL fetches u, retrying transient failures with jittered exponential
+// backoff. A Retry-After longer than the backoff is honored; one beyond
+// MaxDelay ends the retries instead, as does a context deadline that leaves
+// no room for the wait plus a full attempt.
+func (f *httpFetcher) getURL(ctx context.Context, u string, freq FetchRequest, text bool) (*FetchResult, error) {
+	scheme, _, _ := strings.Cut(u, "://")
+	for attempt := 1; ; attempt++ {
+		res, err := f.fetchOnce(ctx, u, freq, text)
+		if err == nil {
+			metrics.IncFetchAttempt(scheme, "ok")
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			metrics.IncFetchAttempt(scheme, "canceled")
+			return nil, err
+		}
+		retry, retryAfter := transient(err)
+		if !retry {
+			metrics.IncFetchAttempt(scheme, "permanent")
+			return nil, err
+		}
+		metrics.IncFetchAttempt(scheme, "transient")
+		if attempt >= f.retry.MaxAttempts || retryAfter > f.retry.MaxDelay {
+			return nil, err
+		}
+		delay := max(f.retry.backoff(attempt), retryAfter)
+		if dl, ok := ctx.Deadline(); ok && time.Until(dl) < delay+f.timeout {
+			return nil, err
+		}
+		if sleepCtx(ctx, delay) != nil {
+			return nil, err
+		}
+	}
+}
+
+// fetchOnce performs a single GET of u, holding an outbound slot for u's
+// host until the body has been read.
+func (f *httpFetcher) fetchOnce(ctx context.Context, u string, freq FetchRequest, text bool) (*FetchResult, error) {
+	hops := &redirectLog{adsTxt: text}
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, redirectLogKey{}, hops), http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.outbound != nil {
+		release, err := f.outbound.Acquire(ctx, req.URL.Hostname())
 		if err != nil {
-			lastErr = err
-			continue
+			return nil, err
 		}
+		defer release()
+	}
+	if freq.ETag != "" {
+		req.Header.Set("If-None-Match", freq.ETag)
+	}
+	if freq.LastModified != "" {
+		req.Header.Set("If-Modified-Since", freq.LastModified)
+	}
+	conditional := freq.ETag != "" || freq.LastModified != ""
+
+	start := time.Now()
+	resp, err := f.client.Do(req)
+	metrics.ObserveFetch(req.URL.Scheme, start)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-		start := time.Now()
-		resp, err := f.client.Do(req)
-		metrics.ObserveFetch(req.URL.Scheme, start)
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		b, truncated, err := readCapped(resp, f.maxBytes, text)
 		if err != nil {
-			lastErr = err
-			continue
+			return nil, err
 		}
-		defer resp.Body.Close()
+		ct := resp.Header.Get("Content-Type")
+		if reason := sniffText(ct, b); text && reason != "" {
+			return nil, &InvalidContentError{Reason: reason, ContentType: ct}
+		}
+		sum := sha256.Sum256(b)
+		return &FetchResult{Body: b, Info: models.FetchInfo{
+			FinalURL:     resp.Request.URL.String(),
+			Scheme:       resp.Request.URL.Scheme,
+			Status:       resp.StatusCode,
+			Bytes:        int64(len(b)),
+			ContentType:  ct,
+			DurationMS:   time.Since(start).Milliseconds(),
+			SHA256:       hex.EncodeToString(sum[:]),
+			Truncated:    truncated,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Redirects:    hops.hops,
+			OffDomain:    util.RegistrableDomain(resp.Request.URL.Hostname()) != util.RegistrableDomain(req.URL.Hostname()),
+		}}, nil
+
+	case resp.StatusCode == http.StatusNotModified && conditional:
+		return &FetchResult{NotModified: true, Info: models.FetchInfo{
+			FinalURL:   resp.Request.URL.String(),
+			Scheme:     resp.Request.URL.Scheme,
+			Status:     resp.StatusCode,
+			DurationMS: time.Since(start).Milliseconds(),
+			Redirects:  hops.hops,
+		}}, nil
+
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%s not found (%s): %w", req.URL.Path[1:], u, &StatusError{Code: http.StatusNotFound})
+
+	default:
+		se := &StatusError{Code: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+		return nil, fmt.Errorf("bad status %d from %s: %w", resp.StatusCode, u, se)
+	}
+}
+
+// maxRedirects bounds every redirect chain, on or off the root domain.
+const maxRedirects = 5
 
-		switch resp.StatusCode {
-		case http.StatusOK:
-			b, err := io.ReadAll(resp.Body)
-			if err != nil {
-				lastErr = err
-				continue
-			}
-			return b, nil
+type redirectLogKey struct{}
 
-		case http.StatusNotFound:
-			lastErr = fmt.Errorf("ads.txt not found (%s): %w", u, &StatusError{Code: http.StatusNotFound})
+// redirectLog collects the redirect hops of one request and selects its
+// redirect policy.
+type redirectLog struct {
+	adsTxt bool // apply the ads.txt policy; otherwise only maxRedirects
+	hops   []models.Redirect
+}
 
-		default:
-			lastErr = fmt.Errorf("bad status %d from %s", resp.StatusCode, u)
+// checkRedirect caps every chain at maxRedirects. For ads.txt and
+// app-ads.txt requests it also applies the ads.txt redirect policy: any
+// number of hops within the original root domain, and one hop to a
+// location outside it, which must then serve the file itself: a redirect
+// issued by a host outside the root domain is refused. Each followed hop is
+// recorded in the request's redirectLog.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	log, _ := req.Context().Value(redirectLogKey{}).(*redirectLog)
+	if log != nil && log.adsTxt {
+		root := util.RegistrableDomain(via[0].URL.Hostname())
+		from := via[len(via)-1]
+		if util.RegistrableDomain(from.URL.Hostname()) != root {
+			return &RedirectError{From: from.URL.String(), To: req.URL.String()}
+		}
+	}
+	if log != nil {
+		hop := models.Redirect{URL: via[len(via)-1].URL.String(), Location: req.URL.String()}
+		if req.Response != nil {
+			hop.Status = req.Response.StatusCode
 		}
+		log.hops = append(log.hops, hop)
 	}
+	return nil
+}
 
-	return nil, lastErr
+// RedirectError reports a redirect refused by the ads.txt redirect policy.
+type RedirectError struct {
+	From, To string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirect from %s to %s: only the publisher's root domain may redirect", e.From, e.To)
+}
+
+// readCapped reads resp.Body into memory, reading at most max+1 bytes
+// (0 => unlimited) and refusing early when Content-Length already exceeds
+// max. Over the cap it fails with *TooLargeError, or with truncate returns
+// the body up to the last newline within the cap and truncated=true.
+func readCapped(resp *http.Response, max int64, truncate bool) (b []byte, truncated bool, err error) {
+	if max <= 0 {
+		b, err = io.ReadAll(resp.Body)
+		return b, false, err
+	}
+	if resp.ContentLength > max && !truncate {
+		return nil, false, &TooLargeError{Limit: max}
+	}
+	b, err = io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(b)) <= max {
+		return b, false, nil
+	}
+	if !truncate {
+		return nil, false, &TooLargeError{Limit: max}
+	}
+	b = b[:max]
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		b = b[:i+1]
+	}
+	return b, true, nil
+}
+
+// TooLargeError reports a response body above the configured size cap.
+type TooLargeError struct {
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("response exceeds %d bytes", e.Limit)
 }
 
 type StatusError struct {
-	Code int
+	Code       int
+	RetryAfter time.Duration // parsed Retry-After header, if any
 }
 
 func (e *StatusError) Error() string {
@@ -2,12 +2,25 @@ package analysis
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/breaker"
+	"github.com/avivbaron/ads-analyzer/internal/cache"
+	"github.com/avivbaron/ads-analyzer/internal/models"
 )
 
+// loopback lets the fetcher reach httptest servers past the SSRF guard.
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
 func TestFetcher_OK(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
@@ -31,14 +44,14 @@ func TestFetcher_HTTPFallbackAnd404(t *testing.T) {
 	}))
 	defer httpSrv.Close()
 	host := httpSrv.URL[len("http://"):]
-	f := NewHTTPFetcher(2*time.Second, true)
+	f := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, AllowCIDRs: loopback})
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	b, err := f.GetAdsTxt(ctx, host)
+	res, err := f.GetAdsTxt(ctx, FetchRequest{Domain: host, Kind: models.KindAdsTxt})
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
-	if len(b) == 0 {
+	if len(res.Body) == 0 {
 		t.Fatalf("empty body")
 	}
 }
@@ -50,9 +63,9 @@ func TestFetcher_NotFound(t *testing.T) {
 	httpSrv := httptest.NewServer(http.NotFoundHandler())
 	defer httpSrv.Close()
 	host := httpSrv.URL[len("http://"):]
-	f := NewHTTPFetcher(2*time.Second, false)
+	f := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, AllowCIDRs: loopback})
 	ctx := context.Background()
-	_, err := f.GetAdsTxt(ctx, host)
+	_, err := f.GetAdsTxt(ctx, FetchRequest{Domain: host, Kind: models.KindAdsTxt})
 	if err == nil {
 		t.Fatalf("want error for 404")
 	}
@@ -69,10 +82,547 @@ func TestFetcher_Timeout(t *testing.T) {
 	}))
 	defer httpSrv.Close()
 	host := httpSrv.URL[len("http://"):]
-	f := NewHTTPFetcher(50*time.Millisecond, true)
+	f := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 50 * time.Millisecond, HTTPFallback: true, AllowCIDRs: loopback})
 	ctx := context.Background()
-	_, err := f.GetAdsTxt(ctx, host)
+	_, err := f.GetAdsTxt(ctx, FetchRequest{Domain: host, Kind: models.KindAdsTxt})
 	if err == nil {
 		t.Fatalf("want timeout error")
 	}
 }
+
+// TestFetcher_AppAdsPath verifies that the app-ads.txt kind requests /app-ads.txt.
+// PASS: body returned from the /app-ads.txt handler.
+// FAIL: error (the server 404s every other path).
+func TestFetcher_AppAdsPath(t *testing.T) {
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app-ads.txt" {
+			w.WriteHeader(404)
+			return
+		}
+		_, _ = w.Write([]byte("google.com, pub-1, DIRECT\n"))
+	}))
+	defer httpSrv.Close()
+	host := httpSrv.URL[len("http://"):]
+	f := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, AllowCIDRs: loopback})
+	res, err := f.GetAdsTxt(context.Background(), FetchRequest{Domain: host, Kind: models.KindAppAdsTxt})
+	if err != nil || len(res.Body) == 0 {
+		t.Fatalf("err=%v res=%v", err, res)
+	}
+}
+
+// TestSellersFetcher_SizeCap ensures sellers.json bodies above the cap fail
+// with *TooLargeError instead of being read fully.
+// PASS: TooLargeError for a 2KB body with a 1KB cap.
+// FAIL: no error, or a different error type.
+func TestSellersFetcher_SizeCap(t *testing.T) {
+	big := strings.Repeat("x", 2048)
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(big))
+	}))
+	defer httpSrv.Close()
+	host := httpSrv.URL[len("http://"):]
+	f := NewHTTPSellersFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, MaxBytes: 1024, AllowCIDRs: loopback})
+	_, err := f.GetSellersJSON(context.Background(), host)
+	var tl *TooLargeError
+	if !errors.As(err, &tl) {
+		t.Fatalf("want TooLargeError, got %v", err)
+	}
+}
+
+// TestFetcher_SSRFGuard verifies that loopback destinations are refused unless
+// allowlisted, including when reached through a redirect from an allowed host.
+// PASS: *BlockedError with range "loopback" for the direct and redirected fetch.
+// FAIL: the request reaches the server or fails with another error.
+func TestFetcher_SSRFGuard(t *testing.T) {
+	var hits int
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_, _ = w.Write([]byte("google.com, x, DIRECT\n"))
+	}))
+	defer internal.Close()
+	internalHost := internal.URL[len("http://"):]
+
+	f := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true})
+	_, err := f.GetAdsTxt(context.Background(), FetchRequest{Domain: internalHost, Kind: models.KindAdsTxt})
+	var be *BlockedError
+	if !errors.As(err, &be) || be.Range != "loopback" {
+		t.Fatalf("want loopback BlockedError, got %v", err)
+	}
+
+	// allow only 127.0.0.2, the redirector; the target on 127.0.0.1 stays blocked
+	redirector := httptest.NewUnstartedServer(http.RedirectHandler(internal.URL+"/ads.txt", http.StatusFound))
+	ln, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 unavailable: %v", err)
+	}
+	redirector.Listener = ln
+	redirector.Start()
+	defer redirector.Close()
+	f = NewHTTPFetcherWithOptions(FetcherOptions{
+		Timeout:      2 * time.Second,
+		HTTPFallback: true,
+		AllowCIDRs:   []netip.Prefix{netip.MustParsePrefix("127.0.0.2/32")},
+	})
+	_, err = f.GetAdsTxt(context.Background(), FetchRequest{Domain: redirector.URL[len("http://"):], Kind: models.KindAdsTxt})
+	if !errors.As(err, &be) || be.Range != "loopback" {
+		t.Fatalf("want redirect to be blocked, got %v", err)
+	}
+	if hits != 0 {
+		t.Fatalf("internal server was reached %d times", hits)
+	}
+}
+
+// TestCheckRedirect_Policy exercises the ads.txt redirect rules: hops within
+// the root domain are free, one hop off the root domain is allowed, and a
+// host outside the root domain may not redirect at all, not even back.
+// Other files (sellers.json) are only held to the hop cap.
+// PASS: for ads.txt the first two chains are allowed and the last two rejected
+// with *RedirectError; for sellers.json all are allowed.
+// FAIL: any verdict differs.
+func TestCheckRedirect_Policy(t *testing.T) {
+	var log *redirectLog
+	req := func(u string) *http.Request {
+		r, _ := http.NewRequestWithContext(context.WithValue(context.Background(), redirectLogKey{}, log), http.MethodGet, u, nil)
+		return r
+	}
+	chains := []struct {
+		urls []string
+		ok   bool
+	}{
+		{[]string{"https://pub.com/ads.txt", "https://www.pub.com/ads.txt", "https://cdn.pub.com/ads.txt"}, true},
+		{[]string{"https://pub.com/ads.txt", "https://www.pub.com/ads.txt", "https://host.net/pub/ads.txt"}, true},
+		{[]string{"https://pub.com/ads.txt", "https://host.net/ads.txt", "https://pub.com/x/ads.txt"}, false},
+		{[]string{"https://pub.com/ads.txt", "https://host.net/ads.txt", "https://cdn.host.net/ads.txt"}, false},
+	}
+	for _, adsTxt := range []bool{true, false} {
+		for _, c := range chains {
+			log = &redirectLog{adsTxt: adsTxt}
+			var via []*http.Request
+			for _, u := range c.urls[:len(c.urls)-1] {
+				via = append(via, req(u))
+			}
+			err := checkRedirect(req(c.urls[len(c.urls)-1]), via)
+			var re *RedirectError
+			ok := c.ok || !adsTxt
+			if ok && err != nil || !ok && !errors.As(err, &re) {
+				t.Fatalf("ads.txt=%v %v: err=%v", adsTxt, c.urls, err)
+			}
+		}
+	}
+}
+
+// TestFetcher_RecordsRedirects checks that the fetch provenance (final URL,
+// scheme, fallback, status, size, content type, digest) and the followed
+// redirects are returned.
+// PASS: provenance matches the served body; one 301 hop from /ads.txt to
+// /real/ads.txt, not off-domain.
+// FAIL: any field or hop differs.
+func TestFetcher_RecordsRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ads.txt" {
+			http.Redirect(w, r, "/real/ads.txt", http.StatusMovedPermanently)
+			return
+		}
+		_, _ = w.Write([]byte("google.com, x, DIRECT\n"))
+	}))
+	defer srv.Close()
+	f := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, AllowCIDRs: loopback})
+	res, err := f.GetAdsTxt(context.Background(), FetchRequest{Domain: srv.URL[len("http://"):], Kind: models.KindAdsTxt})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	info := res.Info
+	if info.FinalURL != srv.URL+"/real/ads.txt" || info.Scheme != "http" || !info.Fallback || info.Status != http.StatusOK ||
+		info.Bytes != 22 || !strings.HasPrefix(info.ContentType, "text/plain") ||
+		info.SHA256 != "02b2851808d897d61c699add66eea3b18fa08dfd5738e8acebc5091fc2393772" {
+		t.Fatalf("bad provenance: %+v", info)
+	}
+	hops := res.Info.Redirects
+	if len(hops) != 1 || hops[0].Status != http.StatusMovedPermanently ||
+		hops[0].URL != srv.URL+"/ads.txt" || hops[0].Location != srv.URL+"/real/ads.txt" || res.Info.OffDomain {
+		t.Fatalf("bad fetch info: %+v", res.Info)
+	}
+}
+
+// TestFetcher_SoftNotFound ensures a 200 HTML page is rejected rather than
+// parsed as an empty ads.txt.
+// PASS: *InvalidContentError with reason html.
+// FAIL: body returned or another error.
+func TestFetcher_SoftNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<!doctype html><html><body>Page not found</body></html>"))
+	}))
+	defer srv.Close()
+	f := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, AllowCIDRs: loopback})
+	_, err := f.GetAdsTxt(context.Background(), FetchRequest{Domain: srv.URL[len("http://"):], Kind: models.KindAdsTxt})
+	var ic *InvalidContentError
+	if !errors.As(err, &ic) || ic.Reason != InvalidHTML {
+		t.Fatalf("want InvalidContentError, got %v", err)
+	}
+}
+
+// TestGetSequential_SoftNotFoundFallsBack ensures a soft-404 page on the
+// first scheme does not hide a valid file on the fallback.
+// PASS: the second URL's file is returned with Fallback set.
+// FAIL: *InvalidContentError from the first URL is returned instead.
+func TestGetSequential_SoftNotFoundFallsBack(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<!doctype html><html><body>Page not found</body></html>"))
+	}))
+	defer page.Close()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("google.com, x, DIRECT\n"))
+	}))
+	defer ok.Close()
+	f := newHTTPFetcher(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, AllowCIDRs: loopback})
+	res, err := f.getSequential(context.Background(), []string{page.URL + "/ads.txt", ok.URL + "/ads.txt"}, FetchRequest{Kind: models.KindAdsTxt}, true)
+	if err != nil || !res.Info.Fallback || string(res.Body) != "google.com, x, DIRECT\n" {
+		t.Fatalf("err=%v res=%+v", err, res)
+	}
+}
+
+// pinnedFetcher sends every ads.txt request to host, so a Service can be
+// pointed at an httptest server while analyzing an ordinary domain.
+type pinnedFetcher struct {
+	Fetcher
+	host string
+}
+
+func (f pinnedFetcher) GetAdsTxt(ctx context.Context, req FetchRequest) (*FetchResult, error) {
+	req.Domain = f.host
+	return f.Fetcher.GetAdsTxt(ctx, req)
+}
+
+// TestFetcher_TruncatesLargeAdsTxt verifies that ads.txt bodies above the cap
+// are cut at the last full line and flagged, and that an analysis of such a
+// file reports the truncation.
+// PASS: body ends at a line boundary within the cap, Truncated is set, and the
+// analysis keeps the full lines and reports truncated and invalid.
+// FAIL: oversize body returned whole, partial line kept, or flag missing.
+func TestFetcher_TruncatesLargeAdsTxt(t *testing.T) {
+	line := "google.com, pub-1234567890, DIRECT\n" // 35 bytes
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat(line, 100)))
+	}))
+	defer srv.Close()
+	f := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, MaxBytes: 100, AllowCIDRs: loopback})
+	res, err := f.GetAdsTxt(context.Background(), FetchRequest{Domain: srv.URL[len("http://"):], Kind: models.KindAdsTxt})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(res.Body) != strings.Repeat(line, 2) || !res.Info.Truncated || res.Info.Bytes != 70 {
+		t.Fatalf("body=%q info=%+v", res.Body, res.Info)
+	}
+
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	svc := NewService(mc, pinnedFetcher{Fetcher: f, host: srv.URL[len("http://"):]}, time.Minute)
+	an, err := svc.Analyze(context.Background(), "example.com", models.AnalyzeOptions{IncludeDiagnostics: true})
+	if err != nil {
+		t.Fatalf("analyze err: %v", err)
+	}
+	v := an.Validation
+	if !v.Truncated || v.Valid || len(an.Records) != 2 || !an.Fetch.Truncated || an.Diagnostics[len(an.Diagnostics)-1].Code != CodeTruncated {
+		t.Fatalf("validation=%#v fetch=%+v diags=%#v", v, an.Fetch, an.Diagnostics)
+	}
+}
+
+// TestFetcher_Conditional checks that validators are sent and a 304 is
+// reported as NotModified, and that responses expose ETag/Last-Modified.
+// PASS: plain GET returns the validators; conditional GET returns NotModified.
+// FAIL: headers missing or 304 treated as an error.
+func TestFetcher_Conditional(t *testing.T) {
+	const etag, lm = `"abc"`, "Wed, 01 Jan 2025 00:00:00 GMT"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lm {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lm)
+		_, _ = w.Write([]byte("google.com, x, DIRECT\n"))
+	}))
+	defer srv.Close()
+	host := srv.URL[len("http://"):]
+	f := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, AllowCIDRs: loopback})
+	res, err := f.GetAdsTxt(context.Background(), FetchRequest{Domain: host, Kind: models.KindAdsTxt})
+	if err != nil || res.NotModified || res.Info.ETag != etag || res.Info.LastModified != lm {
+		t.Fatalf("plain: err=%v res=%+v", err, res)
+	}
+	res, err = f.GetAdsTxt(context.Background(), FetchRequest{Domain: host, Kind: models.KindAdsTxt, ETag: etag, LastModified: lm})
+	if err != nil || !res.NotModified || res.Info.Status != http.StatusNotModified || len(res.Body) != 0 {
+		t.Fatalf("conditional: err=%v res=%+v", err, res)
+	}
+}
+
+// TestFetcher_Retry checks that transient statuses are retried and permanent
+// ones are not, and that a Retry-After above the cap ends the retries.
+// PASS: 503 then 200 succeeds on the 2nd attempt; 403 and a long
+// Retry-After stop after 1 attempt.
+// FAIL: wrong attempt counts or a transient failure surfaced as an error.
+func TestFetcher_Retry(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		retryAfter string
+		wantErr    bool
+		wantCalls  int
+	}{
+		{"transient then ok", http.StatusServiceUnavailable, "0", false, 2},
+		{"permanent", http.StatusForbidden, "", true, 1},
+		{"retry-after over cap", http.StatusTooManyRequests, "3600", true, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls == 1 {
+					if tc.retryAfter != "" {
+						w.Header().Set("Retry-After", tc.retryAfter)
+					}
+					w.WriteHeader(tc.status)
+					return
+				}
+				_, _ = w.Write([]byte("google.com, x, DIRECT\n"))
+			}))
+			defer srv.Close()
+			f := NewHTTPFetcherWithOptions(FetcherOptions{
+				Timeout:    2 * time.Second,
+				AllowCIDRs: loopback,
+				Retry:      RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+			})
+			_, err := f.(*httpFetcher).getURL(context.Background(), srv.URL+"/ads.txt", FetchRequest{}, true)
+			if (err != nil) != tc.wantErr || calls != tc.wantCalls {
+				t.Fatalf("err=%v calls=%d, want err=%v calls=%d", err, calls, tc.wantErr, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// TestTransient checks the error classification and Retry-After parsing.
+// PASS: timeouts/resets/503 are transient with the parsed delay; policy
+// errors are permanent.
+// FAIL: a misclassified error.
+func TestTransient(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if d := parseRetryAfter("Wed, 01 Jan 2025 00:00:30 GMT", now); d != 30*time.Second {
+		t.Fatalf("http-date Retry-After = %v", d)
+	}
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&StatusError{Code: 503, RetryAfter: time.Second}, true},
+		{fmt.Errorf("wrapped: %w", &StatusError{Code: 429}), true},
+		{&StatusError{Code: 404}, false},
+		{&StatusError{Code: 500}, false},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, false},
+		{context.DeadlineExceeded, true},
+		{&BlockedError{Range: "loopback"}, false},
+		{&RedirectError{From: "a", To: "b"}, false},
+		{&TooLargeError{}, false},
+		{errors.New("boom"), false},
+	}
+	for _, tc := range cases {
+		if got, _ := transient(tc.err); got != tc.want {
+			t.Errorf("transient(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+	if _, d := transient(&StatusError{Code: 503, RetryAfter: time.Second}); d != time.Second {
+		t.Errorf("retry-after = %v", d)
+	}
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, hi := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		if d := p.backoff(attempt); d < hi/2 || d > hi {
+			t.Errorf("backoff(%d) = %v, want in [%v, %v]", attempt, d, hi/2, hi)
+		}
+	}
+}
+
+// TestFetcher_CircuitBreaker checks that origin failures open the domain's
+// circuit and that a definite answer such as 404 does not.
+// PASS: after 2 failed fetches the 3rd fails fast with *breaker.OpenError
+// without reaching the server; 404s never trip it.
+// FAIL: the server is hit while open, or 404s open the circuit.
+func TestFetcher_CircuitBreaker(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	host := srv.URL[len("http://"):]
+
+	mc := cache.NewMemory(cache.MemoryOptions{})
+	defer mc.Close()
+	f := NewHTTPFetcherWithOptions(FetcherOptions{
+		Timeout:      2 * time.Second,
+		HTTPFallback: true,
+		AllowCIDRs:   loopback,
+		Breaker:      breaker.New(mc, breaker.Options{Threshold: 2, Cooldown: time.Hour}),
+	})
+	req := FetchRequest{Domain: host, Kind: models.KindAdsTxt}
+
+	status = http.StatusNotFound
+	for i := 0; i < 3; i++ {
+		if _, err := f.GetAdsTxt(context.Background(), req); errors.Is(err, breaker.ErrOpen) {
+			t.Fatalf("404 tripped the circuit: %v", err)
+		}
+	}
+
+	status = http.StatusServiceUnavailable
+	for i := 0; i < 2; i++ {
+		if _, err := f.GetAdsTxt(context.Background(), req); err == nil || errors.Is(err, breaker.ErrOpen) {
+			t.Fatalf("fetch %d: want upstream error, got %v", i+1, err)
+		}
+	}
+	before := calls
+	_, err := f.GetAdsTxt(context.Background(), req)
+	var oe *breaker.OpenError
+	if !errors.As(err, &oe) || calls != before {
+		t.Fatalf("want fast failure, got err=%v calls=%d->%d", err, before, calls)
+	}
+}
+
+// TestFetcher_HostVariants checks that ads.txt is looked up on the www
+// variant when the requested host has none, in input order. Every
+// connection goes to one test server, which only serves www.example.com.
+// PASS: both spellings are served by www.example.com with fetch.host set;
+// validators only go to the requested host; a 500 does not fall through;
+// without variants the 404 is returned.
+// FAIL: wrong serving host, extra lookups, or a missing error.
+func TestFetcher_HostVariants(t *testing.T) {
+	var seen, inm []string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Host)
+		inm = append(inm, r.Header.Get("If-None-Match"))
+		if r.Host != "www.example.com" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("google.com, x, DIRECT\n"))
+	}))
+	defer srv.Close()
+	newFetcher := func(hv HostVariants) *httpFetcher {
+		f := newHTTPFetcher(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, HostVariants: hv})
+		f.client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+		}
+		return f
+	}
+	ctx := context.Background()
+
+	f := newFetcher(HostVariantsWWW)
+	for _, c := range []struct {
+		domain string
+		seen   []string
+	}{
+		{"example.com", []string{"example.com", "www.example.com"}},
+		{"www.example.com", []string{"www.example.com"}},
+	} {
+		seen = nil
+		res, err := f.GetAdsTxt(ctx, FetchRequest{Domain: c.domain, Kind: models.KindAdsTxt})
+		if err != nil || res.Info.Host != "www.example.com" || strings.Join(seen, ",") != strings.Join(c.seen, ",") {
+			t.Fatalf("%s: err=%v res=%+v seen=%v", c.domain, err, res, seen)
+		}
+	}
+
+	inm = nil
+	if _, err := f.GetAdsTxt(ctx, FetchRequest{Domain: "example.com", Kind: models.KindAdsTxt, ETag: `"bare"`}); err != nil || strings.Join(inm, ",") != `"bare",` {
+		t.Fatalf("validators leaked to the variant: err=%v if-none-match=%q", err, inm)
+	}
+
+	status = http.StatusInternalServerError
+	seen = nil
+	if _, err := f.GetAdsTxt(ctx, FetchRequest{Domain: "www.example.com", Kind: models.KindAdsTxt}); err == nil || len(seen) != 1 {
+		t.Fatalf("500 fell through to the bare host: err=%v seen=%v", err, seen)
+	}
+
+	var se *StatusError
+	if _, err := newFetcher(HostVariantsNone).GetAdsTxt(ctx, FetchRequest{Domain: "example.com", Kind: models.KindAdsTxt}); !errors.As(err, &se) || se.Code != http.StatusNotFound {
+		t.Fatalf("without variants: want 404, got %v", err)
+	}
+}
+
+// TestFetcher_HostVariants_OpenCircuit checks that an open circuit on the
+// requested host fails fast instead of falling through to its www variant.
+// PASS: *breaker.OpenError returned and no request reaches the server.
+// FAIL: the variant is fetched or its 404 replaces the circuit error.
+func TestFetcher_HostVariants_OpenCircuit(t *testing.T) {
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Host)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	mc := cache.NewMemory(cache.MemoryOptions{})
+	defer mc.Close()
+	b := breaker.New(mc, breaker.Options{Threshold: 1})
+	b.Failure(context.Background(), "example.com")
+	f := newHTTPFetcher(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, HostVariants: HostVariantsWWW, Breaker: b})
+	f.client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+
+	var oe *breaker.OpenError
+	if _, err := f.GetAdsTxt(context.Background(), FetchRequest{Domain: "example.com", Kind: models.KindAdsTxt}); !errors.As(err, &oe) || len(seen) != 0 {
+		t.Fatalf("want open circuit and no requests, got err=%v seen=%v", err, seen)
+	}
+}
+
+// TestFetcher_Deadline checks that one deadline bounds the whole fetch and
+// that running out of it counts against the origin's circuit.
+// PASS: a hanging origin fails with context.DeadlineExceeded well before the
+// per-attempt timeout and opens its circuit; a retry that cannot fit in the
+// remaining time is not started.
+// FAIL: the fetch outlives the deadline, the circuit stays closed, or the
+// origin is hit again.
+func TestFetcher_Deadline(t *testing.T) {
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hang.Close()
+	mc := cache.NewMemory(cache.MemoryOptions{})
+	defer mc.Close()
+	f := NewHTTPFetcherWithOptions(FetcherOptions{
+		Timeout:      5 * time.Second,
+		Deadline:     100 * time.Millisecond,
+		HTTPFallback: true,
+		AllowCIDRs:   loopback,
+		Breaker:      breaker.New(mc, breaker.Options{Threshold: 1, Cooldown: time.Hour}),
+	})
+	req := FetchRequest{Domain: hang.URL[len("http://"):], Kind: models.KindAdsTxt}
+	start := time.Now()
+	_, err := f.GetAdsTxt(context.Background(), req)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 2*time.Second {
+		t.Fatalf("err=%v after %v", err, time.Since(start))
+	}
+	if _, err := f.GetAdsTxt(context.Background(), req); !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("deadline did not count against the circuit: %v", err)
+	}
+
+	calls := 0
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer busy.Close()
+	f = NewHTTPFetcherWithOptions(FetcherOptions{
+		Timeout:      time.Second,
+		Deadline:     500 * time.Millisecond,
+		HTTPFallback: true,
+		AllowCIDRs:   loopback,
+		Retry:        RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	})
+	req = FetchRequest{Domain: busy.URL[len("http://"):], Kind: models.KindAdsTxt}
+	if _, err := f.GetAdsTxt(context.Background(), req); err == nil || calls != 1 {
+		t.Fatalf("err=%v calls=%d", err, calls)
+	}
+}
@@ -0,0 +1,79 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// FetchMode selects how the https:// and http:// URLs of a file are tried.
+type FetchMode string
+
+const (
+	// FetchSequential tries http:// only after https:// has failed.
+	FetchSequential FetchMode = "sequential"
+	// FetchHedged also starts http:// when https:// has not answered within
+	// the hedge delay; the first valid response wins and the other is
+	// cancelled; a soft-404 or non-text body counts as a failed attempt.
+	FetchHedged FetchMode = "hedged"
+	// FetchHTTPSOnly never falls back to plain http://.
+	FetchHTTPSOnly FetchMode = "https-only"
+)
+
+// getHedged races urls[0] (https) against urls[1] (http), started after
+// f.hedgeDelay or as soon as https fails. Blocked and oversized responses
+// end the race, since the other scheme reaches the same host and file.
+func (f *httpFetcher) getHedged(ctx context.Context, urls []string, freq FetchRequest, text bool) (*FetchResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the losing attempt
+
+	type outcome struct {
+		i   int
+		res *FetchResult
+		err error
+	}
+	done := make(chan outcome, len(urls))
+	launched := 0
+	launch := func() {
+		i := launched
+		launched++
+		go func() {
+			res, err := f.getURL(ctx, urls[i], freq, text)
+			done <- outcome{i, res, err}
+		}()
+	}
+
+	launch()
+	hedge := time.NewTimer(f.hedgeDelay)
+	defer hedge.Stop()
+
+	errs := make([]error, len(urls))
+	for pending := 1; pending > 0; {
+		select {
+		case <-hedge.C:
+			if launched < len(urls) {
+				launch()
+				pending++
+			}
+		case o := <-done:
+			pending--
+			if o.err == nil {
+				o.res.Info.Fallback = o.i > 0
+				o.res.Info.Hedged = launched > 1
+				return o.res, nil
+			}
+			var be *BlockedError
+			var tl *TooLargeError
+			if errors.As(o.err, &be) || errors.As(o.err, &tl) {
+				return nil, o.err
+			}
+			errs[o.i] = o.err
+			if launched < len(urls) {
+				launch()
+				pending++
+			}
+		}
+	}
+	// every URL failed; like the sequential mode, report the fallback's error
+	return nil, errs[len(errs)-1]
+}
@@ -0,0 +1,114 @@
+package analysis
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/models"
+)
+
+// TestGetHedged races a primary and a fallback URL in hedged mode.
+// PASS: a hung primary loses to the fallback after the hedge delay and is
+// cancelled; a failing primary starts the fallback at once; a fast primary
+// never starts the fallback.
+// FAIL: wrong winner, Fallback/Hedged flags, or the loser keeps running.
+func TestGetHedged(t *testing.T) {
+	var primaryCancelled atomic.Bool
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		primaryCancelled.Store(true)
+	}))
+	defer hung.Close()
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	var okCalls atomic.Int64
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		okCalls.Add(1)
+		_, _ = w.Write([]byte("google.com, x, DIRECT\n"))
+	}))
+	defer ok.Close()
+
+	newFetcher := func(delay time.Duration) *httpFetcher {
+		return newHTTPFetcher(FetcherOptions{Timeout: 5 * time.Second, HTTPFallback: true, Mode: FetchHedged, HedgeDelay: delay, AllowCIDRs: loopback})
+	}
+	freq := FetchRequest{Kind: models.KindAdsTxt}
+
+	start := time.Now()
+	res, err := newFetcher(20*time.Millisecond).getHedged(context.Background(), []string{hung.URL + "/ads.txt", ok.URL + "/ads.txt"}, freq, true)
+	if err != nil || !res.Info.Fallback || !res.Info.Hedged {
+		t.Fatalf("hung primary: err=%v res=%+v", err, res)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("hedge waited for the primary: %v", d)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !primaryCancelled.Load() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !primaryCancelled.Load() {
+		t.Fatalf("losing attempt was not cancelled")
+	}
+
+	res, err = newFetcher(time.Hour).getHedged(context.Background(), []string{missing.URL + "/ads.txt", ok.URL + "/ads.txt"}, freq, true)
+	if err != nil || !res.Info.Fallback {
+		t.Fatalf("failed primary: err=%v res=%+v", err, res)
+	}
+
+	okCalls.Store(0)
+	res, err = newFetcher(time.Hour).getHedged(context.Background(), []string{ok.URL + "/ads.txt", hung.URL + "/ads.txt"}, freq, true)
+	if err != nil || res.Info.Fallback || res.Info.Hedged || okCalls.Load() != 1 {
+		t.Fatalf("fast primary: err=%v res=%+v", err, res)
+	}
+}
+
+// TestGetHedged_SoftNotFoundLoses ensures a fast soft-404 page on the
+// hedged URL does not beat a slower valid file on the primary.
+// PASS: the primary's file is returned without Fallback.
+// FAIL: *InvalidContentError, or the primary was cancelled.
+func TestGetHedged_SoftNotFoundLoses(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("google.com, x, DIRECT\n"))
+	}))
+	defer slow.Close()
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><body>Not found</body></html>"))
+	}))
+	defer page.Close()
+	f := newHTTPFetcher(FetcherOptions{Timeout: 5 * time.Second, HTTPFallback: true, Mode: FetchHedged, HedgeDelay: 10 * time.Millisecond, AllowCIDRs: loopback})
+	res, err := f.getHedged(context.Background(), []string{slow.URL + "/ads.txt", page.URL + "/ads.txt"}, FetchRequest{Kind: models.KindAdsTxt}, true)
+	if err != nil || res.Info.Fallback || !res.Info.Hedged {
+		t.Fatalf("err=%v res=%+v", err, res)
+	}
+}
+
+// TestFetcher_HTTPSOnly checks that https-only mode never falls back.
+// PASS: https-only never reaches the plain-http server, while hedged mode
+// falls back to it and records its mode.
+// FAIL: https-only runs the handler or the mode is missing from the result.
+func TestFetcher_HTTPSOnly(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte("google.com, x, DIRECT\n"))
+	}))
+	defer srv.Close()
+	host := srv.URL[len("http://"):]
+	req := FetchRequest{Domain: host, Kind: models.KindAdsTxt}
+
+	strict := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, Mode: FetchHTTPSOnly, AllowCIDRs: loopback})
+	if _, err := strict.GetAdsTxt(context.Background(), req); err == nil || calls.Load() != 0 {
+		t.Fatalf("https-only reached http: err=%v calls=%d", err, calls.Load())
+	}
+
+	hedged := NewHTTPFetcherWithOptions(FetcherOptions{Timeout: 2 * time.Second, HTTPFallback: true, Mode: FetchHedged, AllowCIDRs: loopback})
+	res, err := hedged.GetAdsTxt(context.Background(), req)
+	if err != nil || res.Info.Mode != string(FetchHedged) || res.Info.Scheme != "http" || !res.Info.Fallback {
+		t.Fatalf("hedged: err=%v res=%+v", err, res)
+	}
+}
@@ -3,30 +3,132 @@ package analysis
 import (
 	"bufio"
 	"bytes"
+	"fmt"
+	"io"
 	"strings"
+
+	"github.com/avivbaron/ads-analyzer/internal/models"
+	"github.com/avivbaron/ads-analyzer/internal/util"
+)
+
+// Diagnostic codes reported by Parse. They are part of the API contract,
+// so never rename an existing code.
+const (
+	CodeEmptyDomain         = "empty_domain"
+	CodeDomainHasSpace      = "domain_has_space"
+	CodeDomainHasAt         = "domain_has_at"
+	CodeDomainNoDot         = "domain_no_dot"
+	CodeDomainBadEdge       = "domain_bad_edge"
+	CodeDomainInvalidIDN    = "domain_invalid_idn"
+	CodeMissingAccountID    = "missing_account_id"
+	CodeMissingRelationship = "missing_relationship"
+	CodeInvalidRelationship = "invalid_relationship"
+	CodeUnknownDirective    = "unknown_directive"
+	CodeEmptyDirective      = "empty_directive"
+	CodeDuplicateRecord     = "duplicate_record"
+	CodeDuplicateOwner      = "duplicate_ownerdomain"
+	CodeLineTooLong         = "line_too_long"
+	CodeReadError           = "read_error"
+	CodeTruncated           = "truncated"
+	CodeEncoding            = "encoding"
 )
 
+// maxLineLen bounds a single line; longer lines are reported and skipped.
+const maxLineLen = 1024 * 1024
+
+// ParseResult is the outcome of a single pass over an ads.txt file.
+type ParseResult struct {
+	Records     []models.AdsTxtRecord
+	Variables   models.Variables
+	Diagnostics []models.Diagnostic
+	Summary     models.ValidationSummary
+	Err         error // read error that ended the pass early; also reported as a diagnostic
+}
+
 // ParseAdsTxt returns a map[seller_domain]count.
+// It is a convenience wrapper around ParseAdsTxtRecords + CountByDomain.
+func ParseAdsTxt(b []byte) map[string]int {
+	return CountByDomain(ParseAdsTxtRecords(b))
+}
+
+// ParseAdsTxtRecords returns the data records of an ads.txt file in file order.
+func ParseAdsTxtRecords(b []byte) []models.AdsTxtRecord {
+	return Parse(b).Records
+}
+
+// Parse walks an ads.txt file once and returns its records together with
+// a diagnostic for every line that was ignored or does not follow the spec.
+func Parse(b []byte) ParseResult {
+	return ParseReader(bytes.NewReader(b))
+}
+
+// ParseReader is Parse over an io.Reader. Lines longer than 1MB are reported and
+// skipped without losing the rest of the file; a read error stops the pass
+// and is returned in ParseResult.Err and as a read_error diagnostic.
+func ParseReader(r io.Reader) ParseResult {
+	return ParseWithContentType(r, "")
+}
+
+// ParseWithContentType is ParseReader for a body served with contentType.
+// The text is transcoded to UTF-8 first (BOM, then the charset parameter,
+// then a UTF-8 validity check falling back to Windows-1252); anything but
+// plain UTF-8 is recorded as an info "encoding" diagnostic.
 //
 // Rules implemented:
-// - Ignore empty lines and full-line comments (# ...)
-// - Strip inline comments starting with #
-// - Ignore directive-style lines where '=' appears before the first comma
-//   (e.g., "contact=...", "subdomain=..."), or no comma but has '='
-// - Split by comma (SplitN=2), trim spaces; first token is the seller domain
-// - Naive domain sanity: non-empty, lowercased, no spaces, has a dot,
-//   no '@', and not starting/ending with '.' or '-'
-func ParseAdsTxt(b []byte) map[string]int {
-	counts := make(map[string]int)
-	s := bufio.NewScanner(bytes.NewReader(b))
-	buf := make([]byte, 0, 1024*1024) // allow long lines up to 1MB
-	s.Buffer(buf, 1024*1024)
-	for s.Scan() {
-		line := strings.TrimSpace(s.Text())
+//   - Ignore empty lines and full-line comments (# ...)
+//   - Strip inline comments starting with # and extension data after ';'
+//   - Treat lines where '=' appears before the first comma (or with no
+//     comma at all) as variables; names are case-insensitive and unknown
+//     ones are reported and kept in Variables.Other
+//   - Split by comma, trim spaces; fields are seller domain, account id,
+//     relationship (upper-cased) and optional certification authority id
+//   - Naive domain sanity: non-empty, lowercased, no spaces, has a dot,
+//     no '@', and not starting/ending with '.' or '-'
+//   - Seller domains (and domain-valued variables) are converted to their
+//     ASCII punycode form; labels that break IDNA rules drop the line
+//
+// Lines with an unusable seller domain are dropped (severity error); records
+// with missing/invalid fields or duplicates are kept but flagged (warning).
+func ParseWithContentType(r io.Reader, contentType string) ParseResult {
+	var res ParseResult
+	seen := make(map[string]int) // domain|account|relationship -> first line
+
+	r, res.Summary.Encoding = decodeText(r, contentType)
+	if res.Summary.Encoding != EncodingUTF8 {
+		res.Diagnostics = append(res.Diagnostics, models.Diagnostic{
+			Severity: models.SeverityInfo, Code: CodeEncoding,
+			Message: "file was decoded from " + res.Summary.Encoding,
+		})
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	lineNo := 0
+	for {
+		text, tooLong, err := readLine(br, maxLineLen)
+		if err != nil {
+			if err != io.EOF {
+				res.Err = err
+				res.Diagnostics = append(res.Diagnostics, models.Diagnostic{
+					Line: lineNo + 1, Severity: models.SeverityError, Code: CodeReadError, Message: err.Error(),
+				})
+			}
+			break
+		}
+		lineNo++
+		if tooLong {
+			res.Diagnostics = append(res.Diagnostics, models.Diagnostic{
+				Line: lineNo, Severity: models.SeverityError, Code: CodeLineTooLong,
+				Message: fmt.Sprintf("line exceeds %d bytes and was skipped", maxLineLen), Text: text,
+			})
+			continue
+		}
+		raw := strings.TrimSpace(text)
+		line := raw
 		if line == "" {
 			continue
 		}
 		if strings.HasPrefix(line, "#") {
+			res.Summary.Comments++
 			continue
 		}
 
@@ -38,37 +140,199 @@ func ParseAdsTxt(b []byte) map[string]int {
 			continue
 		}
 
-		// Skip if there's an '=' BEFORE the first comma,
+		diag := func(sev, code, msg string) {
+			res.Diagnostics = append(res.Diagnostics, models.Diagnostic{
+				Line: lineNo, Severity: sev, Code: code, Message: msg, Text: raw,
+			})
+		}
+
+		// Directive if there's an '=' BEFORE the first comma,
 		// or if there's no comma at all but line contains '='.
 		comma := strings.IndexByte(line, ',')
 		eq := strings.IndexByte(line, '=')
 		if eq >= 0 && (comma == -1 || eq < comma) {
+			res.Summary.Directives++
+			key := strings.ToLower(strings.TrimSpace(line[:eq]))
+			val := strings.TrimSpace(line[eq+1:])
+			if val == "" {
+				diag(models.SeverityWarning, CodeEmptyDirective, fmt.Sprintf("directive %q has no value", key))
+				continue
+			}
+			switch key {
+			case "contact":
+				res.Variables.Contact = append(res.Variables.Contact, val)
+			case "subdomain":
+				res.Variables.Subdomain = append(res.Variables.Subdomain, canonDomain(val))
+			case "inventorypartnerdomain":
+				res.Variables.InventoryPartnerDomain = append(res.Variables.InventoryPartnerDomain, canonDomain(val))
+			case "managerdomain":
+				res.Variables.ManagerDomain = append(res.Variables.ManagerDomain, lowerDomainPart(val))
+			case "ownerdomain":
+				if res.Variables.OwnerDomain != "" {
+					diag(models.SeverityWarning, CodeDuplicateOwner, "only the first OWNERDOMAIN is used")
+					continue
+				}
+				res.Variables.OwnerDomain = canonDomain(val)
+			default:
+				if res.Variables.Other == nil {
+					res.Variables.Other = make(map[string][]string)
+				}
+				res.Variables.Other[key] = append(res.Variables.Other[key], val)
+				diag(models.SeverityWarning, CodeUnknownDirective, fmt.Sprintf("unknown directive %q is not part of the spec", key))
+			}
 			continue
 		}
 
-		// We only need the first field (seller domain),
-		// so split at most once.
-		parts := strings.SplitN(line, ",", 2)
+		// extension fields follow a ';' and are not part of the record
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+
+		parts := strings.Split(line, ",")
 		p0 := strings.ToLower(strings.TrimSpace(parts[0]))
-		if p0 == "" {
+		if code, msg := checkSellerDomain(p0); code != "" {
+			diag(models.SeverityError, code, msg)
 			continue
 		}
-		if strings.Contains(p0, " ") { // malformed domain
+		p0, err = util.ToASCII(p0)
+		if err != nil {
+			diag(models.SeverityError, CodeDomainInvalidIDN, fmt.Sprintf("seller domain is not a valid domain name (%v)", err))
 			continue
 		}
-		// naive domain shape check (contains a dot)
-		if !strings.Contains(p0, ".") {
-			continue
+
+		rec := models.AdsTxtRecord{Domain: p0, Line: lineNo, Raw: raw}
+		if len(parts) > 1 {
+			rec.AccountID = strings.TrimSpace(parts[1])
+		}
+		if len(parts) > 2 {
+			rec.Relationship = strings.ToUpper(strings.TrimSpace(parts[2]))
+		}
+		if len(parts) > 3 {
+			rec.CertID = strings.TrimSpace(parts[3])
 		}
 
-		// domains shouldn't contain '@' and shouldn't start/end with '.' or '-'
-		if strings.Contains(p0, "@") {
-			continue
+		if rec.AccountID == "" {
+			diag(models.SeverityWarning, CodeMissingAccountID, "record has no publisher account id")
+		}
+		switch rec.Relationship {
+		case models.RelationshipDirect, models.RelationshipReseller:
+		case "":
+			diag(models.SeverityWarning, CodeMissingRelationship, "record has no relationship (DIRECT or RESELLER)")
+		default:
+			diag(models.SeverityWarning, CodeInvalidRelationship, fmt.Sprintf("relationship %q is not DIRECT or RESELLER", rec.Relationship))
+		}
+
+		key := rec.Domain + "|" + strings.ToLower(rec.AccountID) + "|" + rec.Relationship
+		if first, dup := seen[key]; dup {
+			diag(models.SeverityWarning, CodeDuplicateRecord, fmt.Sprintf("duplicate of line %d", first))
+		} else {
+			seen[key] = lineNo
+		}
+
+		res.Records = append(res.Records, rec)
+	}
+
+	res.Summary.Lines = lineNo
+	res.Summary.Records = len(res.Records)
+	for _, d := range res.Diagnostics {
+		switch d.Severity {
+		case models.SeverityError:
+			res.Summary.Errors++
+		case models.SeverityWarning:
+			res.Summary.Warnings++
+		}
+	}
+	res.Summary.Valid = res.Summary.Errors == 0
+	return res
+}
+
+// markTruncated records that the input was cut short before the parse, so
+// the file cannot be considered valid.
+func (r *ParseResult) markTruncated() {
+	r.Diagnostics = append(r.Diagnostics, models.Diagnostic{
+		Line: r.Summary.Lines + 1, Severity: models.SeverityError, Code: CodeTruncated,
+		Message: "file exceeds the fetch size limit; the remaining lines were not read",
+	})
+	r.Summary.Errors++
+	r.Summary.Truncated = true
+	r.Summary.Valid = false
+}
+
+// readLine returns the next line without its line ending. A line longer
+// than max is consumed up to its newline and returned as its first 80 bytes
+// with tooLong set. A final line without a newline is returned with a nil
+// error; err is io.EOF only once the input is exhausted.
+func readLine(br *bufio.Reader, max int) (line string, tooLong bool, err error) {
+	var buf []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !tooLong {
+			if len(buf)+len(chunk) > max+2 { // room for "\r\n"
+				tooLong = true
+				buf = append(buf[:0:0], buf[:min(len(buf), 80)]...)
+			} else {
+				buf = append(buf, chunk...)
+			}
 		}
-		if p0[0] == '.' || p0[len(p0)-1] == '.' || p0[0] == '-' || p0[len(p0)-1] == '-' {
+		switch {
+		case err == bufio.ErrBufferFull:
 			continue
+		case err == io.EOF && (len(buf) > 0 || tooLong):
+			// last line without a trailing newline
+		case err != nil:
+			return "", false, err
 		}
-		counts[p0]++
+		return strings.TrimRight(string(buf), "\r\n"), tooLong, nil
+	}
+}
+
+// CountByDomain returns a map[seller_domain]count for the given records.
+func CountByDomain(recs []models.AdsTxtRecord) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range recs {
+		counts[r.Domain]++
 	}
 	return counts
 }
+
+// checkSellerDomain returns a diagnostic code and message when d cannot be
+// used as a seller domain, or empty strings if it looks fine.
+func checkSellerDomain(d string) (string, string) {
+	if d == "" {
+		return CodeEmptyDomain, "record has an empty seller domain"
+	}
+	if strings.Contains(d, " ") { // malformed domain
+		return CodeDomainHasSpace, "seller domain contains spaces"
+	}
+	// naive domain shape check (contains a dot)
+	if !strings.Contains(d, ".") {
+		return CodeDomainNoDot, "seller domain has no dot"
+	}
+	// domains shouldn't contain '@' and shouldn't start/end with '.' or '-'
+	if strings.Contains(d, "@") {
+		return CodeDomainHasAt, "seller domain contains '@'"
+	}
+	if d[0] == '.' || d[len(d)-1] == '.' || d[0] == '-' || d[len(d)-1] == '-' {
+		return CodeDomainBadEdge, "seller domain starts or ends with '.' or '-'"
+	}
+	return "", ""
+}
+
+// lowerDomainPart canonicalizes the domain in "domain[,CC]" values and keeps
+// the optional country code as written.
+func lowerDomainPart(v string) string {
+	d, cc, ok := strings.Cut(v, ",")
+	if !ok {
+		return canonDomain(v)
+	}
+	return canonDomain(strings.TrimSpace(d)) + "," + strings.TrimSpace(cc)
+}
+
+// canonDomain returns the ASCII form of a domain-valued directive, falling
+// back to the lower-cased value when it is not a valid IDN.
+func canonDomain(v string) string {
+	if a, err := util.ToASCII(v); err == nil {
+		return a
+	}
+	return strings.ToLower(v)
+}
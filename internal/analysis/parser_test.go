@@ -1,6 +1,10 @@
 package analysis
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+)
 
 // TestParseAdsTxt_Basics checks that parser:
 // - ignores comments and blank lines,
@@ -57,3 +61,170 @@ appnexus.com, 1, RESELLER, abc
 		t.Fatalf("bad counts: %#v", m)
 	}
 }
+
+// TestParseAdsTxtRecords_Fields checks that every record field is captured:
+// domain, account id, relationship (upper-cased), cert id, line number and raw line.
+// PASS: two records with the expected fields; directive and comment lines skipped.
+// FAIL: missing record or any field mismatch.
+func TestParseAdsTxtRecords_Fields(t *testing.T) {
+	in := []byte("# header\ncontact=ads@example.com\nGoogle.com, pub-123, direct, f08c47fec0942fa0 # inline\nappnexus.com, 42, RESELLER;ext=1\n")
+	recs := ParseAdsTxtRecords(in)
+	if len(recs) != 2 {
+		t.Fatalf("len=%d want 2: %#v", len(recs), recs)
+	}
+	g := recs[0]
+	if g.Domain != "google.com" || g.AccountID != "pub-123" || g.Relationship != "DIRECT" || g.CertID != "f08c47fec0942fa0" {
+		t.Fatalf("bad google record: %#v", g)
+	}
+	if g.Line != 3 || g.Raw != "Google.com, pub-123, direct, f08c47fec0942fa0 # inline" {
+		t.Fatalf("bad google line/raw: %#v", g)
+	}
+	a := recs[1]
+	if a.Domain != "appnexus.com" || a.AccountID != "42" || a.Relationship != "RESELLER" || a.CertID != "" || a.Line != 4 {
+		t.Fatalf("bad appnexus record: %#v", a)
+	}
+}
+
+// TestParse_Diagnostics checks that ignored and non-conforming lines are
+// reported with their line number, severity and stable code.
+// PASS: each expected (line, code, severity) diagnostic is present and summary counts match.
+// FAIL: any diagnostic missing or summary mismatch.
+func TestParse_Diagnostics(t *testing.T) {
+	in := []byte(`# comment
+google.com, pub-1, DIRECT
+google.com, pub-1, DIRECT
+appnexus.com, 1
+rubicon project.com, 2, DIRECT
+ads@x.com, 3, DIRECT
+openx.com, 4, PARTNER
+foo=bar
+contact=
+`)
+	res := Parse(in)
+	want := []struct {
+		line int
+		code string
+		sev  string
+	}{
+		{3, CodeDuplicateRecord, "warning"},
+		{4, CodeMissingRelationship, "warning"},
+		{5, CodeDomainHasSpace, "error"},
+		{6, CodeDomainHasAt, "error"},
+		{7, CodeInvalidRelationship, "warning"},
+		{8, CodeUnknownDirective, "warning"},
+		{9, CodeEmptyDirective, "warning"},
+	}
+	for _, w := range want {
+		found := false
+		for _, d := range res.Diagnostics {
+			if d.Line == w.line && d.Code == w.code && d.Severity == w.sev {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("missing diagnostic line=%d code=%s: %#v", w.line, w.code, res.Diagnostics)
+		}
+	}
+	sum := res.Summary
+	if sum.Records != 4 || sum.Errors != 2 || sum.Warnings != 5 || sum.Valid {
+		t.Fatalf("bad summary: %#v", sum)
+	}
+	if sum.Lines != 9 || sum.Comments != 1 || sum.Directives != 2 {
+		t.Fatalf("bad line counts: %#v", sum)
+	}
+}
+
+// TestParse_Variables checks that ads.txt variables are parsed case-insensitively
+// into their typed fields and that unknown variables land in Other.
+// PASS: every variable is present with the expected value.
+// FAIL: any variable missing, misplaced, or records affected.
+func TestParse_Variables(t *testing.T) {
+	in := []byte(`CONTACT=ads@example.com
+Contact=https://example.com/ads
+subdomain=Sports.Example.com
+InventoryPartnerDomain=partner.tv
+OWNERDOMAIN=example.com
+ownerdomain=other.com
+MANAGERDOMAIN=Manager.com,US
+seller_id=123
+google.com, pub-1, DIRECT
+`)
+	res := Parse(in)
+	v := res.Variables
+	if len(v.Contact) != 2 || v.Contact[0] != "ads@example.com" {
+		t.Fatalf("contact=%#v", v.Contact)
+	}
+	if len(v.Subdomain) != 1 || v.Subdomain[0] != "sports.example.com" {
+		t.Fatalf("subdomain=%#v", v.Subdomain)
+	}
+	if len(v.InventoryPartnerDomain) != 1 || v.InventoryPartnerDomain[0] != "partner.tv" {
+		t.Fatalf("inventorypartnerdomain=%#v", v.InventoryPartnerDomain)
+	}
+	if v.OwnerDomain != "example.com" {
+		t.Fatalf("ownerdomain=%q", v.OwnerDomain)
+	}
+	if len(v.ManagerDomain) != 1 || v.ManagerDomain[0] != "manager.com,US" {
+		t.Fatalf("managerdomain=%#v", v.ManagerDomain)
+	}
+	if got := v.Other["seller_id"]; len(got) != 1 || got[0] != "123" {
+		t.Fatalf("other=%#v", v.Other)
+	}
+	if len(res.Records) != 1 {
+		t.Fatalf("records=%d want 1", len(res.Records))
+	}
+}
+
+// TestParse_IDNSellerDomains checks that Unicode seller domains are converted
+// to punycode and that labels breaking IDNA rules drop the line.
+// PASS: one record with the ASCII domain; a domain_invalid_idn error on line 2.
+// FAIL: Unicode domain kept, or the bad label accepted.
+func TestParse_IDNSellerDomains(t *testing.T) {
+	res := Parse([]byte("Bücher.de, 1, DIRECT\nab--cd.com, 2, DIRECT\n"))
+	if len(res.Records) != 1 || res.Records[0].Domain != "xn--bcher-kva.de" {
+		t.Fatalf("records %#v", res.Records)
+	}
+	if len(res.Diagnostics) != 1 || res.Diagnostics[0].Code != CodeDomainInvalidIDN || res.Diagnostics[0].Line != 2 {
+		t.Fatalf("diagnostics %#v", res.Diagnostics)
+	}
+}
+
+// errReader yields data and then a non-EOF error.
+type errReader struct {
+	data []byte
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// TestParseReader_LongLinesAndErrors checks that an over-long line is reported
+// and skipped without losing later lines, and that read errors are surfaced.
+// PASS: records before and after the long line are kept with a line_too_long error;
+// a failing reader yields Err plus a read_error diagnostic and an invalid summary.
+// FAIL: lines lost after the long line, or the read error swallowed.
+func TestParseReader_LongLinesAndErrors(t *testing.T) {
+	in := "google.com, 1, DIRECT\n" + strings.Repeat("x", maxLineLen+10) + "\nappnexus.com, 2, RESELLER"
+	res := ParseReader(strings.NewReader(in))
+	if len(res.Records) != 2 || res.Records[1].Line != 3 || res.Summary.Lines != 3 || res.Err != nil {
+		t.Fatalf("records=%#v lines=%d err=%v", res.Records, res.Summary.Lines, res.Err)
+	}
+	if len(res.Diagnostics) != 1 || res.Diagnostics[0].Code != CodeLineTooLong || res.Diagnostics[0].Line != 2 {
+		t.Fatalf("diagnostics %#v", res.Diagnostics)
+	}
+
+	boom := errors.New("connection reset")
+	res = ParseReader(&errReader{data: []byte("google.com, 1, DIRECT\n"), err: boom})
+	if !errors.Is(res.Err, boom) || len(res.Records) != 1 || res.Summary.Valid {
+		t.Fatalf("err=%v records=%d summary=%#v", res.Err, len(res.Records), res.Summary)
+	}
+	if d := res.Diagnostics[len(res.Diagnostics)-1]; d.Code != CodeReadError || d.Line != 2 {
+		t.Fatalf("read error diagnostic %#v", d)
+	}
+}
@@ -0,0 +1,113 @@
+package analysis
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how often a single URL is retried on transient
+// failures before the fetcher moves on (to the http fallback or an error).
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per URL, including the first; 0 => 1 (no retries)
+	BaseDelay   time.Duration // backoff before the second attempt; 0 => 200ms
+	MaxDelay    time.Duration // backoff cap; a longer Retry-After gives up; 0 => 5s
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 1
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 200 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+	return p
+}
+
+// backoff returns the jittered delay after the given failed attempt (1-based):
+// BaseDelay doubled per attempt, capped at MaxDelay, then scaled into [d/2, d].
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int64N(half+1))
+}
+
+// retryable statuses: the origin or its CDN is overloaded or restarting.
+var retryableStatus = map[int]bool{
+	http.StatusRequestTimeout:     true,
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// transient reports whether err is worth retrying and any server-requested
+// delay. Policy violations, size caps, TLS failures, refused connections and
+// other statuses are permanent.
+func transient(err error) (bool, time.Duration) {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return retryableStatus[se.Code], se.RetryAfter
+	}
+	var (
+		be  *BlockedError
+		re  *RedirectError
+		tl  *TooLargeError
+		ic  *InvalidContentError
+		uae x509.UnknownAuthorityError
+		hne x509.HostnameError
+		cie x509.CertificateInvalidError
+	)
+	if errors.As(err, &be) || errors.As(err, &re) || errors.As(err, &tl) || errors.As(err, &ic) ||
+		errors.As(err, &uae) || errors.As(err, &hne) || errors.As(err, &cie) {
+		return false, 0
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true, 0
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true, 0
+	}
+	return false, 0
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// sleepCtx waits for d or until ctx is done, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
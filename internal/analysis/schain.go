@@ -0,0 +1,110 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/models"
+	"github.com/avivbaron/ads-analyzer/internal/util"
+)
+
+// ErrNoSellers is returned by ValidateSChain when the Service was built
+// without a SellersService, so schain nodes cannot be checked.
+var ErrNoSellers = errors.New("sellers.json lookups are not configured")
+
+// ValidateSChain checks an OpenRTB schain against real data: the first
+// node's asi/sid must appear in the publisher's ads.txt (via Analyze, so it
+// is cached), and every node's sid must exist in its asi's sellers.json with
+// a seller_type that fits its position in the chain.
+func (s *Service) ValidateSChain(ctx context.Context, req models.SChainValidateRequest) (models.SChainReport, error) {
+	rep := models.SChainReport{Complete: req.SChain.Complete == 1, Valid: true}
+	if s.sellers == nil {
+		return rep, ErrNoSellers
+	}
+	kind, err := models.ParseFileKind(req.Type)
+	if err != nil {
+		return rep, err
+	}
+
+	var records []models.AdsTxtRecord
+	ads, adsErr := s.Analyze(ctx, req.Domain, models.AnalyzeOptions{Kind: kind})
+	if errors.Is(adsErr, util.ErrBadDomain) {
+		return rep, adsErr
+	}
+	if adsErr == nil {
+		rep.Domain = ads.Domain
+		records = ads.Records
+	} else {
+		rep.Domain = req.Domain
+	}
+
+	for i, n := range req.SChain.Nodes {
+		v := models.SChainNodeVerdict{Index: i, ASI: n.ASI, SID: n.SID, Valid: true}
+		asi := strings.ToLower(strings.TrimSpace(n.ASI))
+		sid := strings.TrimSpace(n.SID)
+
+		// The seller of node 0 is paid by the publisher; later sellers
+		// are intermediaries reselling the previous hop.
+		relationship := models.RelationshipReseller
+		if i == 0 {
+			switch {
+			case adsErr != nil:
+				v.AdsTxt = models.SChainAdsTxtUnavailable
+				v.Error = adsErr.Error()
+				v.Valid = false
+			default:
+				rec, ok := findRecord(records, asi, sid)
+				if ok {
+					v.AdsTxt = models.SChainAdsTxtMatched
+					v.Relationship = rec.Relationship
+					relationship = rec.Relationship
+				} else {
+					v.AdsTxt = models.SChainAdsTxtMissing
+					v.Valid = false
+				}
+			}
+		}
+
+		idx, err := s.sellers.index(ctx, asi)
+		switch {
+		case err != nil:
+			v.Sellers = models.SellersUnavailable
+			if v.Error == "" {
+				v.Error = err.Error()
+			}
+			v.Valid = false
+		default:
+			seller, ok := idx.ByID[strings.ToLower(sid)]
+			switch {
+			case !ok:
+				v.Sellers = models.SellersMissingSellerID
+				v.Valid = false
+			case !typeAgrees(relationship, seller.Type):
+				v.Sellers = models.SellersTypeMismatch
+				v.Valid = false
+			default:
+				v.Sellers = models.SellersMatched
+			}
+			if ok {
+				v.SellerType = seller.Type
+				v.SellerName = seller.Name
+			}
+		}
+
+		rep.Valid = rep.Valid && v.Valid
+		rep.Nodes = append(rep.Nodes, v)
+	}
+	rep.Timestamp = time.Now().UTC()
+	return rep, nil
+}
+
+func findRecord(records []models.AdsTxtRecord, domain, accountID string) (models.AdsTxtRecord, bool) {
+	for _, r := range records {
+		if r.Domain == domain && strings.EqualFold(r.AccountID, accountID) {
+			return r, true
+		}
+	}
+	return models.AdsTxtRecord{}, false
+}
@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/cache"
+	"github.com/avivbaron/ads-analyzer/internal/models"
+)
+
+// TestService_ValidateSChain validates a two-node chain: the first node is
+// authorized DIRECT in ads.txt and listed as PUBLISHER; the second node's sid
+// is missing from its sellers.json. A repeated validation hits the caches.
+// PASS: node 0 valid, node 1 missing_seller_id, report invalid; no extra fetches on repeat.
+// FAIL: wrong verdicts or repeated fetches.
+func TestService_ValidateSChain(t *testing.T) {
+	ctx := context.Background()
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	ff := &fakeFetcher{data: []byte("ssp.com, PUB-1, DIRECT\n")}
+	sf := &fakeSellersFetcher{files: map[string]string{
+		"ssp.com": `{"sellers":[{"seller_id":"pub-1","seller_type":"PUBLISHER","name":"Pub"}]}`,
+		"mid.com": `{"sellers":[{"seller_id":"other","seller_type":"INTERMEDIARY"}]}`,
+	}}
+	svc := NewServiceWithOptions(mc, ff, ServiceOptions{TTL: time.Minute, Sellers: NewSellersService(mc, sf, time.Hour)})
+	req := models.SChainValidateRequest{
+		Domain: "publisher.com",
+		SChain: models.SChain{Complete: 1, Nodes: []models.SChainNode{
+			{ASI: "ssp.com", SID: "pub-1", HP: 1},
+			{ASI: "mid.com", SID: "r-9", HP: 1},
+		}},
+	}
+	rep, err := svc.ValidateSChain(ctx, req)
+	if err != nil {
+		t.Fatalf("validate err: %v", err)
+	}
+	if rep.Valid || !rep.Complete || len(rep.Nodes) != 2 {
+		t.Fatalf("bad report: %#v", rep)
+	}
+	n0, n1 := rep.Nodes[0], rep.Nodes[1]
+	if !n0.Valid || n0.AdsTxt != models.SChainAdsTxtMatched || n0.Relationship != "DIRECT" || n0.Sellers != models.SellersMatched {
+		t.Fatalf("bad node 0: %#v", n0)
+	}
+	if n1.Valid || n1.AdsTxt != "" || n1.Sellers != models.SellersMissingSellerID {
+		t.Fatalf("bad node 1: %#v", n1)
+	}
+
+	calls := sf.calls
+	if _, err := svc.ValidateSChain(ctx, req); err != nil {
+		t.Fatalf("validate2 err: %v", err)
+	}
+	if ff.calls != 1 || sf.calls != calls {
+		t.Fatalf("expected cached lookups: ads=%d sellers=%d->%d", ff.calls, calls, sf.calls)
+	}
+}
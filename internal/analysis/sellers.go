@@ -0,0 +1,286 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/cache"
+	"github.com/avivbaron/ads-analyzer/internal/metrics"
+	"github.com/avivbaron/ads-analyzer/internal/models"
+	"github.com/avivbaron/ads-analyzer/internal/util"
+)
+
+// rawSeller mirrors one sellers.json entry loosely: real-world files use
+// numbers for seller_id and booleans for the 0/1 integer flags, so both are
+// accepted.
+type rawSeller struct {
+	SellerID       json.RawMessage `json:"seller_id"`
+	Name           string          `json:"name"`
+	Domain         string          `json:"domain"`
+	SellerType     string          `json:"seller_type"`
+	IsConfidential flexBool        `json:"is_confidential"`
+	IsPassthrough  flexBool        `json:"is_passthrough"`
+	Comment        string          `json:"comment"`
+}
+
+// ErrInvalidSellersJSON is wrapped by errors for a sellers.json body that is
+// not a valid sellers.json document.
+var ErrInvalidSellersJSON = errors.New("invalid sellers.json")
+
+// flexBool decodes true/false, 0/1 and "0"/"1".
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(strings.ToLower(string(data)), `"`) {
+	case "1", "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// ParseSellersJSON decodes a sellers.json document. Seller types are
+// upper-cased and domains converted to lower-case ASCII (punycode) so they
+// can be compared directly with ads.txt records.
+func ParseSellersJSON(b []byte) (models.SellersJSON, error) {
+	var sellers []models.Seller
+	out, err := decodeSellers(bytes.NewReader(b), func(sl models.Seller) {
+		sellers = append(sellers, sl)
+	})
+	if err != nil {
+		return models.SellersJSON{}, err
+	}
+	out.Sellers = sellers
+	if out.Sellers == nil {
+		out.Sellers = []models.Seller{}
+	}
+	return out, nil
+}
+
+// decodeSellers decodes a sellers.json document from r token by token,
+// handing each normalized seller to fn as soon as it is decoded, so the
+// sellers array is never built up as Go values. The returned document has
+// the top-level fields only.
+func decodeSellers(r io.Reader, fn func(models.Seller)) (models.SellersJSON, error) {
+	var out models.SellersJSON
+	dec := json.NewDecoder(r)
+	invalid := func(err error) (models.SellersJSON, error) {
+		return models.SellersJSON{}, fmt.Errorf("%w: %w", ErrInvalidSellersJSON, err)
+	}
+	if err := expectDelim(dec, '{'); err != nil {
+		return invalid(err)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return invalid(err)
+		}
+		switch tok {
+		case "contact_email":
+			err = dec.Decode(&out.ContactEmail)
+		case "contact_address":
+			err = dec.Decode(&out.ContactAddress)
+		case "version":
+			var v any
+			if err = dec.Decode(&v); v != nil {
+				out.Version = fmt.Sprint(v)
+			}
+		case "sellers":
+			err = decodeSellerArray(dec, fn)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return invalid(err)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return invalid(err)
+	}
+	return out, nil
+}
+
+// decodeSellerArray decodes the "sellers" value (an array or null) one
+// entry at a time.
+func decodeSellerArray(dec *json.Decoder, fn func(models.Seller)) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("sellers: want array, got %v", tok)
+	}
+	for dec.More() {
+		var rs rawSeller
+		if err := dec.Decode(&rs); err != nil {
+			return err
+		}
+		fn(models.Seller{
+			SellerID:       rawID(rs.SellerID),
+			Name:           rs.Name,
+			Domain:         canonDomain(strings.TrimSpace(rs.Domain)),
+			SellerType:     strings.ToUpper(strings.TrimSpace(rs.SellerType)),
+			IsConfidential: bool(rs.IsConfidential),
+			IsPassthrough:  bool(rs.IsPassthrough),
+			Comment:        rs.Comment,
+		})
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("want %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// rawID turns a JSON string or number into its trimmed string form.
+func rawID(m json.RawMessage) string {
+	m = bytes.TrimSpace(m)
+	var s string
+	if err := json.Unmarshal(m, &s); err == nil {
+		return strings.TrimSpace(s)
+	}
+	if string(m) == "null" {
+		return ""
+	}
+	return string(m)
+}
+
+// SellersService fetches, indexes and caches sellers.json files.
+type SellersService struct {
+	cache   cache.Cache
+	fetcher SellersFetcher
+	ttl     time.Duration
+}
+
+func NewSellersService(c cache.Cache, f SellersFetcher, ttl time.Duration) *SellersService {
+	return &SellersService{cache: c, fetcher: f, ttl: ttl}
+}
+
+// sellersIndex is what the sellers cache stores for one sellers.json: the
+// lookups the checks and the supply-chain walk need, and the stats. The
+// document itself is not kept.
+type sellersIndex struct {
+	ByID           map[string]sellerEntry `json:"by_id"`          // lower-cased seller_id -> its first entry
+	Intermediaries []sellerEntry          `json:"intermediaries"` // INTERMEDIARY/BOTH entries with a domain, in file order
+	Stats          models.SellersStats    `json:"stats"`
+}
+
+// sellerEntry is the part of a seller that lookups use; which fields are
+// set depends on where it is stored.
+type sellerEntry struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// index returns the sellers.json index of the ad system rawDomain. The
+// fetched body is buffered whole (up to the fetcher's MaxBytes) and decoded
+// from memory, so a miss briefly holds both the body and the index; only the
+// index is cached.
+func (s *SellersService) index(ctx context.Context, rawDomain string) (sellersIndex, error) {
+	var idx sellersIndex
+
+	domain, err := util.NormalizeDomain(rawDomain)
+	if err != nil {
+		return idx, err
+	}
+
+	cacheKey := "sellers:" + domain
+	hit, _ := s.cache.Get(ctx, cacheKey, &idx)
+	if hit {
+		metrics.IncHit("sellers")
+		idx.Stats.Cached = true
+		return idx, nil
+	}
+	metrics.IncMiss("sellers")
+
+	b, err := s.fetcher.GetSellersJSON(ctx, domain)
+	if err != nil {
+		return idx, err
+	}
+	idx, err = buildSellersIndex(bytes.NewReader(b), domain)
+	if err != nil {
+		return idx, err
+	}
+	_ = s.cache.Set(ctx, cacheKey, idx, s.ttl)
+	return idx, nil
+}
+
+// Stats returns counts by seller_type, confidential/passthrough sellers,
+// duplicate seller_ids and the seller domains of rawDomain's sellers.json.
+func (s *SellersService) Stats(ctx context.Context, rawDomain string) (models.SellersStats, error) {
+	idx, err := s.index(ctx, rawDomain)
+	if err != nil {
+		return models.SellersStats{}, err
+	}
+	return idx.Stats, nil
+}
+
+// buildSellersIndex decodes the sellers.json in r into its index.
+func buildSellersIndex(r io.Reader, domain string) (sellersIndex, error) {
+	idx := sellersIndex{ByID: make(map[string]sellerEntry)}
+	st := models.SellersStats{
+		Domain:             domain,
+		DomainUnicode:      util.ToUnicode(domain),
+		ByType:             make(map[string]int),
+		DuplicateSellerIDs: []string{},
+		SellerDomains:      []string{},
+	}
+	ids := make(map[string]int)
+	domains := make(map[string]struct{})
+	doc, err := decodeSellers(r, func(sl models.Seller) {
+		st.TotalSellers++
+		st.ByType[sl.SellerType]++
+		if sl.IsConfidential {
+			st.Confidential++
+		}
+		if sl.IsPassthrough {
+			st.Passthrough++
+		}
+		ids[sl.SellerID]++
+		if ids[sl.SellerID] == 2 {
+			st.DuplicateSellerIDs = append(st.DuplicateSellerIDs, sl.SellerID)
+		}
+		if sl.Domain != "" {
+			domains[sl.Domain] = struct{}{}
+		}
+
+		id := strings.ToLower(sl.SellerID)
+		if _, dup := idx.ByID[id]; !dup {
+			idx.ByID[id] = sellerEntry{Name: sl.Name, Type: sl.SellerType}
+		}
+		if sl.Domain != "" && (sl.SellerType == models.SellerTypeIntermediary || sl.SellerType == models.SellerTypeBoth) {
+			idx.Intermediaries = append(idx.Intermediaries, sellerEntry{ID: sl.SellerID, Type: sl.SellerType, Domain: sl.Domain})
+		}
+	})
+	if err != nil {
+		return sellersIndex{}, err
+	}
+	st.Version = doc.Version
+	st.ContactEmail = doc.ContactEmail
+	for d := range domains {
+		st.SellerDomains = append(st.SellerDomains, d)
+	}
+	sort.Strings(st.SellerDomains)
+	sort.Strings(st.DuplicateSellerIDs)
+	st.Timestamp = time.Now().UTC()
+	idx.Stats = st
+	return idx, nil
+}
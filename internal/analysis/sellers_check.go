@@ -0,0 +1,108 @@
+package analysis
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/avivbaron/ads-analyzer/internal/models"
+)
+
+// sellersCheckWorkers bounds concurrent sellers.json lookups per check.
+const sellersCheckWorkers = 8
+
+// loadedIndex is an ad system's sellers.json index, or the error that
+// prevented loading it.
+type loadedIndex struct {
+	byID map[string]sellerEntry
+	err  error
+}
+
+// Check verifies every DIRECT/RESELLER record against its ad system's
+// sellers.json: the seller_id must exist and its seller_type must agree
+// with the relationship (DIRECT => PUBLISHER/BOTH, RESELLER => INTERMEDIARY/BOTH).
+func (s *SellersService) Check(ctx context.Context, records []models.AdsTxtRecord) models.SellersCheck {
+	var systems []string
+	seen := make(map[string]bool)
+	for _, r := range records {
+		if !checkable(r) || seen[r.Domain] {
+			continue
+		}
+		seen[r.Domain] = true
+		systems = append(systems, r.Domain)
+	}
+
+	indexes := s.loadIndexes(ctx, systems)
+
+	out := models.SellersCheck{Entries: []models.SellersCheckEntry{}}
+	for _, r := range records {
+		if !checkable(r) {
+			continue
+		}
+		e := models.SellersCheckEntry{Line: r.Line, Domain: r.Domain, AccountID: r.AccountID, Relationship: r.Relationship}
+		idx := indexes[r.Domain]
+		seller, found := idx.byID[strings.ToLower(r.AccountID)]
+		switch {
+		case idx.err != nil:
+			e.Status = models.SellersUnavailable
+			e.Error = idx.err.Error()
+			out.Summary.Unavailable++
+		case !found:
+			e.Status = models.SellersMissingSellerID
+			out.Summary.MissingSellerID++
+		case !typeAgrees(r.Relationship, seller.Type):
+			e.Status = models.SellersTypeMismatch
+			out.Summary.TypeMismatch++
+		default:
+			e.Status = models.SellersMatched
+			out.Summary.Matched++
+		}
+		if found {
+			e.SellerType = seller.Type
+			e.SellerName = seller.Name
+		}
+		out.Summary.Checked++
+		out.Entries = append(out.Entries, e)
+	}
+	return out
+}
+
+// loadIndexes fetches the sellers.json of each ad system with bounded concurrency.
+func (s *SellersService) loadIndexes(ctx context.Context, systems []string) map[string]loadedIndex {
+	out := make(map[string]loadedIndex, len(systems))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, sellersCheckWorkers)
+	for _, d := range systems {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			idx, err := s.index(ctx, d)
+			mu.Lock()
+			out[d] = loadedIndex{byID: idx.ByID, err: err}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+func checkable(r models.AdsTxtRecord) bool {
+	return r.AccountID != "" &&
+		(r.Relationship == models.RelationshipDirect || r.Relationship == models.RelationshipReseller)
+}
+
+func typeAgrees(relationship, sellerType string) bool {
+	switch sellerType {
+	case models.SellerTypeBoth:
+		return true
+	case models.SellerTypePublisher:
+		return relationship == models.RelationshipDirect
+	case models.SellerTypeIntermediary:
+		return relationship == models.RelationshipReseller
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/cache"
+	"github.com/avivbaron/ads-analyzer/internal/models"
+)
+
+// fakeSellersFetcher serves a sellers.json body per ad system domain.
+type fakeSellersFetcher struct {
+	mu    sync.Mutex
+	files map[string]string
+	calls int
+}
+
+func (f *fakeSellersFetcher) GetSellersJSON(ctx context.Context, domain string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	body, ok := f.files[domain]
+	if !ok {
+		return nil, errors.New("sellers.json not found")
+	}
+	return []byte(body), nil
+}
+
+// TestParseSellersJSON_Flexible checks that numeric seller ids and 0/1 or boolean
+// flags are accepted and that seller types/domains are normalized.
+// PASS: both sellers decoded with the expected id, type, domain and flags.
+// FAIL: decode error or any field mismatch.
+func TestParseSellersJSON_Flexible(t *testing.T) {
+	in := []byte(`{"version":1.0,"contact_email":"a@b.com","sellers":[
+		{"seller_id":"pub-1","name":"Pub","domain":"Pub.COM","seller_type":"publisher","is_passthrough":1},
+		{"seller_id":12345,"seller_type":"INTERMEDIARY","is_confidential":true}
+	]}`)
+	sj, err := ParseSellersJSON(in)
+	if err != nil {
+		t.Fatalf("parse err: %v", err)
+	}
+	if len(sj.Sellers) != 2 || sj.Version != "1" {
+		t.Fatalf("bad doc: %#v", sj)
+	}
+	a, b := sj.Sellers[0], sj.Sellers[1]
+	if a.SellerID != "pub-1" || a.SellerType != "PUBLISHER" || a.Domain != "pub.com" || !a.IsPassthrough || a.IsConfidential {
+		t.Fatalf("bad seller a: %#v", a)
+	}
+	if b.SellerID != "12345" || b.SellerType != "INTERMEDIARY" || !b.IsConfidential {
+		t.Fatalf("bad seller b: %#v", b)
+	}
+	if _, err := ParseSellersJSON([]byte("<html>")); err == nil {
+		t.Fatalf("want error for non-JSON body")
+	}
+}
+
+// TestBuildSellersIndex checks the streamed index: unknown keys are skipped,
+// seller_ids are looked up case-insensitively by their first entry and only
+// intermediaries with a domain are kept for the supply-chain walk.
+// PASS: index and stats match the document; null sellers and non-object bodies behave.
+// FAIL: wrong entries, counts, or a malformed body accepted.
+func TestBuildSellersIndex(t *testing.T) {
+	idx, err := buildSellersIndex(strings.NewReader(`{"identifiers":[{"name":"TAG-ID","value":"x"}],"sellers":[
+		{"seller_id":"ABC","name":"First","seller_type":"PUBLISHER"},
+		{"seller_id":"abc","name":"Second","seller_type":"INTERMEDIARY","domain":"mid.com"},
+		{"seller_id":"n","seller_type":"BOTH"}
+	],"version":"1.0"}`), "ssp.com")
+	if err != nil {
+		t.Fatalf("build err: %v", err)
+	}
+	if e := idx.ByID["abc"]; e.Name != "First" || e.Type != models.SellerTypePublisher || len(idx.ByID) != 2 {
+		t.Fatalf("bad by_id: %#v", idx.ByID)
+	}
+	if len(idx.Intermediaries) != 1 || idx.Intermediaries[0] != (sellerEntry{ID: "abc", Type: models.SellerTypeIntermediary, Domain: "mid.com"}) {
+		t.Fatalf("bad intermediaries: %#v", idx.Intermediaries)
+	}
+	if idx.Stats.TotalSellers != 3 || idx.Stats.Version != "1.0" || len(idx.Stats.SellerDomains) != 1 {
+		t.Fatalf("bad stats: %#v", idx.Stats)
+	}
+
+	if idx, err := buildSellersIndex(strings.NewReader(`{"sellers":null}`), "ssp.com"); err != nil || idx.Stats.TotalSellers != 0 {
+		t.Fatalf("null sellers: %v %#v", err, idx.Stats)
+	}
+	for _, bad := range []string{`[]`, `{"sellers":{}}`, `{"sellers":[{"seller_id":"1"}`} {
+		if _, err := buildSellersIndex(strings.NewReader(bad), "ssp.com"); err == nil {
+			t.Fatalf("want error for %s", bad)
+		}
+	}
+}
+
+// TestSellersService_Check verifies the cross-check verdicts and that each
+// sellers.json is fetched once and then served from cache.
+// PASS: matched, missing_seller_id, type_mismatch and sellers_unavailable each counted once;
+// a second check causes no new fetch for the available ad system.
+// FAIL: wrong verdicts or repeated fetches.
+func TestSellersService_Check(t *testing.T) {
+	ctx := context.Background()
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	sf := &fakeSellersFetcher{files: map[string]string{
+		"google.com": `{"sellers":[{"seller_id":"pub-1","seller_type":"PUBLISHER"},{"seller_id":"pub-2","seller_type":"PUBLISHER"}]}`,
+	}}
+	ss := NewSellersService(mc, sf, time.Hour)
+	recs := ParseAdsTxtRecords([]byte(`google.com, pub-1, DIRECT
+google.com, pub-2, RESELLER
+google.com, pub-9, DIRECT
+appnexus.com, 1, RESELLER
+openx.com, 2
+`))
+	check := ss.Check(ctx, recs)
+	sum := check.Summary
+	if sum.Checked != 4 || sum.Matched != 1 || sum.TypeMismatch != 1 || sum.MissingSellerID != 1 || sum.Unavailable != 1 {
+		t.Fatalf("bad summary: %#v", sum)
+	}
+	if check.Entries[0].Status != models.SellersMatched || check.Entries[3].Status != models.SellersUnavailable || check.Entries[3].Error == "" {
+		t.Fatalf("bad entries: %#v", check.Entries)
+	}
+	calls := sf.calls
+	_ = ss.Check(ctx, recs)
+	if sf.calls != calls+1 { // only the unavailable appnexus.com is retried
+		t.Fatalf("calls=%d want %d", sf.calls, calls+1)
+	}
+}
+
+// TestSellersService_Stats verifies sellers.json stats and their caching.
+// PASS: type counts, confidential/passthrough, duplicates and domains match; second call cached.
+// FAIL: any stat mismatch or second call not cached.
+func TestSellersService_Stats(t *testing.T) {
+	ctx := context.Background()
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	sf := &fakeSellersFetcher{files: map[string]string{
+		"ssp.com": `{"sellers":[
+			{"seller_id":"1","seller_type":"PUBLISHER","domain":"b.com"},
+			{"seller_id":"2","seller_type":"INTERMEDIARY","domain":"a.com","is_passthrough":1},
+			{"seller_id":"2","seller_type":"BOTH","domain":"a.com"},
+			{"seller_id":"3","seller_type":"PUBLISHER","is_confidential":1}
+		]}`,
+	}}
+	ss := NewSellersService(mc, sf, time.Hour)
+	st, err := ss.Stats(ctx, "SSP.com")
+	if err != nil {
+		t.Fatalf("stats err: %v", err)
+	}
+	if st.Domain != "ssp.com" || st.TotalSellers != 4 || st.ByType["PUBLISHER"] != 2 || st.ByType["INTERMEDIARY"] != 1 || st.ByType["BOTH"] != 1 {
+		t.Fatalf("bad counts: %#v", st)
+	}
+	if st.Confidential != 1 || st.Passthrough != 1 {
+		t.Fatalf("bad flags: %#v", st)
+	}
+	if len(st.DuplicateSellerIDs) != 1 || st.DuplicateSellerIDs[0] != "2" {
+		t.Fatalf("bad duplicates: %#v", st.DuplicateSellerIDs)
+	}
+	if len(st.SellerDomains) != 2 || st.SellerDomains[0] != "a.com" {
+		t.Fatalf("bad domains: %#v", st.SellerDomains)
+	}
+	st2, _ := ss.Stats(ctx, "ssp.com")
+	if !st2.Cached || sf.calls != 1 {
+		t.Fatalf("cached=%v calls=%d", st2.Cached, sf.calls)
+	}
+}
@@ -1,6 +1,7 @@
 package analysis
 
 import (
+	"bytes"
 	"context"
 	"sort"
 	"time"
@@ -11,59 +12,313 @@ import (
 	"github.com/avivbaron/ads-analyzer/internal/util"
 )
 
+type ServiceOptions struct {
+	TTL               time.Duration   // cache TTL for analysis results
+	MaxSubdomains     int             // max SUBDOMAIN directives followed per file; 0 => default
+	MaxSubdomainDepth int             // max nesting when following subdomains; 0 => default
+	Sellers           *SellersService // enables CheckSellers/SupplyChain; may be nil
+	SupplyChain       SupplyChainOptions
+	Aliases           *Aliases // exchange domain -> SSP name, for models.GroupAlias; may be nil
+	// RevalidateWindow keeps expired entries that carry an ETag or
+	// Last-Modified this much longer, for conditional re-fetching. 0 => off.
+	RevalidateWindow time.Duration
+	Now              func() time.Time // clock; nil => time.Now
+	// MergeWWW analyzes www.<domain> and <domain> as one publisher: one
+	// cache entry, reported under <domain>. Pair it with HostVariantsWWW.
+	MergeWWW bool
+}
+
 type Service struct {
 	cache   cache.Cache
 	fetcher Fetcher
 	ttl     time.Duration
+
+	maxSubdomains     int
+	maxSubdomainDepth int
+	sellers           *SellersService
+	supplyChain       SupplyChainOptions
+	aliases           *Aliases
+	revalidateWindow  time.Duration
+	now               func() time.Time
+	mergeWWW          bool
 }
 
 func NewService(c cache.Cache, f Fetcher, ttl time.Duration) *Service {
-	return &Service{cache: c, fetcher: f, ttl: ttl}
+	return NewServiceWithOptions(c, f, ServiceOptions{TTL: ttl})
+}
+
+func NewServiceWithOptions(c cache.Cache, f Fetcher, opt ServiceOptions) *Service {
+	if opt.MaxSubdomains <= 0 {
+		opt.MaxSubdomains = 10
+	}
+	if opt.MaxSubdomainDepth <= 0 {
+		opt.MaxSubdomainDepth = 1
+	}
+	if opt.Now == nil {
+		opt.Now = time.Now
+	}
+	return &Service{
+		cache:             c,
+		fetcher:           f,
+		ttl:               opt.TTL,
+		maxSubdomains:     opt.MaxSubdomains,
+		maxSubdomainDepth: opt.MaxSubdomainDepth,
+		sellers:           opt.Sellers,
+		supplyChain:       opt.SupplyChain,
+		aliases:           opt.Aliases,
+		revalidateWindow:  opt.RevalidateWindow,
+		now:               opt.Now,
+		mergeWWW:          opt.MergeWWW,
+	}
+}
+
+// Analyze fetches, parses and aggregates the ads.txt file of rawDomain.
+// Results are cached with their diagnostics; opts only shapes the response.
+func (s *Service) Analyze(ctx context.Context, rawDomain string, opts models.AnalyzeOptions) (models.AnalysisResult, error) {
+	kind := opts.Kind
+	if kind == "" {
+		kind = models.KindAdsTxt
+	}
+	res, err := s.analyze(ctx, rawDomain, kind)
+	if err != nil {
+		return res, err
+	}
+	if opts.FollowSubdomains {
+		visited := map[string]bool{res.Domain: true}
+		res.Subdomains = s.followSubdomains(ctx, res, 1, visited)
+		if len(res.Subdomains) > 0 {
+			res.MergedAdvertisers, _ = advertiserCounts(treeRecords(res))
+		}
+	}
+	if opts.Group != "" && opts.Group != models.GroupRaw {
+		res.GroupedAdvertisers = groupAdvertisers(res.Advertisers, opts.Group, s.aliases)
+	}
+	if opts.CheckSellers && s.sellers != nil {
+		check := s.sellers.Check(ctx, res.Records)
+		res.SellersCheck = &check
+	}
+	if opts.SupplyChain && s.sellers != nil {
+		graph := s.sellers.SupplyChain(ctx, res.Records, s.supplyChain)
+		res.SupplyChain = &graph
+	}
+	shapeResult(&res, opts)
+	return res, nil
+}
+
+// shapeResult drops the optional parts of res (and its subdomains)
+// that were not requested.
+func shapeResult(res *models.AnalysisResult, opts models.AnalyzeOptions) {
+	if !opts.IncludeDiagnostics {
+		res.Diagnostics = nil
+	}
+	for i := range res.Subdomains {
+		shapeResult(&res.Subdomains[i], opts)
+	}
+}
+
+// Validate returns the lint report for the given file of rawDomain.
+// It shares the analysis cache, so validating an analyzed domain is free.
+func (s *Service) Validate(ctx context.Context, rawDomain string, kind models.FileKind) (models.ValidationReport, error) {
+	if kind == "" {
+		kind = models.KindAdsTxt
+	}
+	res, err := s.analyze(ctx, rawDomain, kind)
+	if err != nil {
+		return models.ValidationReport{}, err
+	}
+	diags := res.Diagnostics
+	if diags == nil {
+		diags = []models.Diagnostic{}
+	}
+	return models.ValidationReport{
+		Domain:        res.Domain,
+		DomainUnicode: res.DomainUnicode,
+		Kind:          res.Kind,
+		Summary:       res.Validation,
+		Diagnostics:   diags,
+		Cached:        res.Cached,
+		Timestamp:     res.Timestamp,
+	}, nil
+}
+
+// analysisKeyPrefix is versioned with the layout of analysisEntry, so entries
+// written by an older release (a bare AnalysisResult) are never decoded as one.
+const analysisKeyPrefix = "analysis:v2:"
+
+// analysisEntry is what the analysis cache stores. It outlives its
+// freshness by the revalidation window, so the origin's validators can
+// turn an expired entry into a cheap 304 instead of a full download.
+type analysisEntry struct {
+	Result       models.AnalysisResult `json:"result"`
+	ETag         string                `json:"etag,omitempty"`
+	LastModified string                `json:"last_modified,omitempty"`
+	FreshUntil   time.Time             `json:"fresh_until"` // zero => fresh while cached
+}
+
+func (e analysisEntry) fresh(now time.Time) bool {
+	return e.FreshUntil.IsZero() || now.Before(e.FreshUntil)
+}
+
+func (e analysisEntry) revalidatable() bool {
+	return e.ETag != "" || e.LastModified != ""
 }
 
-func (s *Service) Analyze(ctx context.Context, rawDomain string) (models.AnalysisResult, error) {
+// freshUntil is the freshness deadline of an entry stored at now; with no
+// TTL the cache backend's default expiry applies instead.
+func (s *Service) freshUntil(now time.Time) time.Time {
+	if s.ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(s.ttl)
+}
+
+func (s *Service) analyze(ctx context.Context, rawDomain string, kind models.FileKind) (models.AnalysisResult, error) {
 	var res models.AnalysisResult
 
-	domain, err := util.NormalizeDomain(rawDomain)
+	host, err := util.NormalizeDomain(rawDomain)
 	if err != nil {
 		return res, err
 	}
+	domain := host
+	if s.mergeWWW {
+		domain = util.StripWWW(host)
+	}
 
-	cacheKey := "analysis:" + domain
-	hit, _ := s.cache.Get(ctx, cacheKey, &res)
-	if hit {
+	cacheKey := analysisKeyPrefix + string(kind) + ":" + domain
+	var entry analysisEntry
+	hit, _ := s.cache.Get(ctx, cacheKey, &entry)
+	now := s.now()
+	if hit && entry.fresh(now) {
 		metrics.IncHit("analysis")
-		res.Cached = true
-		return res, nil
+		entry.Result.Cached = true
+		return entry.Result, nil
+	}
+	stale := hit && entry.revalidatable()
+	if !stale {
+		metrics.IncMiss("analysis")
 	}
-	metrics.IncMiss("analysis")
 
-	b, err := s.fetcher.GetAdsTxt(ctx, domain)
+	// the requested spelling decides which host variant is tried first;
+	// a revalidation goes to the host that issued the validators instead
+	freq := FetchRequest{Domain: host, Kind: kind}
+	if stale {
+		freq.ETag, freq.LastModified = entry.ETag, entry.LastModified
+		if f := entry.Result.Fetch; f != nil && f.Host != "" {
+			freq.Domain = f.Host
+		}
+	}
+	fr, err := s.fetcher.GetAdsTxt(ctx, freq)
 	if err != nil {
 		return res, err
 	}
-	counts := ParseAdsTxt(b)
-	var list []models.AdvertiserCount
-	list = make([]models.AdvertiserCount, 0, len(counts))
-	total := 0
-	for d, c := range counts {
-		list = append(list, models.AdvertiserCount{Domain: d, Count: c})
-		total += c
+	if stale && fr.NotModified {
+		metrics.IncRevalidation("not_modified")
+		entry.FreshUntil = s.freshUntil(now)
+		_ = s.cache.Set(ctx, cacheKey, entry, s.ttl+s.revalidateWindow)
+		entry.Result.Cached = true
+		return entry.Result, nil
+	}
+	if stale {
+		metrics.IncRevalidation("modified")
 	}
-	sort.Slice(list, func(i, j int) bool {
-		if list[i].Count != list[j].Count {
-			return list[i].Count > list[j].Count
-		}
-		return list[i].Domain < list[j].Domain
-	})
+
+	parsed := ParseWithContentType(bytes.NewReader(fr.Body), fr.Info.ContentType)
+	if fr.Info.Truncated {
+		parsed.markTruncated()
+	}
+	list, tot := advertiserCounts(parsed.Records)
 
 	res = models.AnalysisResult{
 		Domain:           domain,
-		TotalAdvertisers: total,
+		DomainUnicode:    util.ToUnicode(domain),
+		Kind:             kind,
+		TotalAdvertisers: tot.all,
+		TotalDirect:      tot.direct,
+		TotalReseller:    tot.reseller,
 		Advertisers:      list,
+		Records:          parsed.Records,
+		Variables:        parsed.Variables,
+		Validation:       parsed.Summary,
+		Diagnostics:      parsed.Diagnostics,
+		Fetch:            &fr.Info,
 		Cached:           false,
-		Timestamp:        time.Now().UTC(),
+		Timestamp:        now.UTC(),
+	}
+	entry = analysisEntry{
+		Result:       res,
+		ETag:         fr.Info.ETag,
+		LastModified: fr.Info.LastModified,
+		FreshUntil:   s.freshUntil(now),
 	}
-	_ = s.cache.Set(ctx, cacheKey, res, s.ttl)
+	keep := s.ttl
+	if entry.revalidatable() && s.ttl > 0 {
+		keep += s.revalidateWindow
+	}
+	_ = s.cache.Set(ctx, cacheKey, entry, keep)
 	return res, nil
 }
+
+// advertiserCounts aggregates records per seller domain, sorted by count desc
+// then domain asc, and returns the list along with the overall totals.
+func advertiserCounts(records []models.AdsTxtRecord) ([]models.AdvertiserCount, totals) {
+	type agg struct {
+		ac       models.AdvertiserCount
+		accounts map[string]struct{}
+		certs    map[string]struct{}
+	}
+	byDomain := make(map[string]*agg)
+	var t totals
+	for _, r := range records {
+		a, ok := byDomain[r.Domain]
+		if !ok {
+			a = &agg{
+				ac:       models.AdvertiserCount{Domain: r.Domain, RegistrableDomain: util.RegistrableDomain(r.Domain)},
+				accounts: make(map[string]struct{}),
+				certs:    make(map[string]struct{}),
+			}
+			if u := util.ToUnicode(r.Domain); u != r.Domain {
+				a.ac.DomainUnicode = u
+			}
+			byDomain[r.Domain] = a
+		}
+		a.ac.Count++
+		t.all++
+		switch r.Relationship {
+		case models.RelationshipDirect:
+			a.ac.Direct++
+			t.direct++
+		case models.RelationshipReseller:
+			a.ac.Reseller++
+			t.reseller++
+		}
+		if r.AccountID != "" {
+			a.accounts[r.AccountID] = struct{}{}
+		}
+		if r.CertID != "" {
+			a.certs[r.CertID] = struct{}{}
+		}
+	}
+
+	list := make([]models.AdvertiserCount, 0, len(byDomain))
+	for _, a := range byDomain {
+		a.ac.AccountIDs = len(a.accounts)
+		for c := range a.certs {
+			a.ac.CertIDs = append(a.ac.CertIDs, c)
+		}
+		sort.Strings(a.ac.CertIDs)
+		list = append(list, a.ac)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Domain < list[j].Domain
+	})
+	return list, t
+}
+
+type totals struct {
+	all      int
+	direct   int
+	reseller int
+}
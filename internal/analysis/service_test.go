@@ -6,17 +6,22 @@ import (
 	"time"
 
 	"github.com/avivbaron/ads-analyzer/internal/cache"
+	"github.com/avivbaron/ads-analyzer/internal/models"
 )
 
 type fakeFetcher struct {
 	calls int
 	data  []byte
+	info  models.FetchInfo
 	err   error
 }
 
-func (f *fakeFetcher) GetAdsTxt(ctx context.Context, domain string) ([]byte, error) {
+func (f *fakeFetcher) GetAdsTxt(ctx context.Context, req FetchRequest) (*FetchResult, error) {
 	f.calls++
-	return f.data, f.err
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &FetchResult{Body: f.data, Info: f.info}, nil
 }
 
 // TestService_Analyze_CachesResult verifies that first Analyze fetches & parses,
@@ -36,7 +41,7 @@ func TestService_Analyze_CachesResult(t *testing.T) {
 	defer mc.Close()
 	ff := &fakeFetcher{data: []byte("google.com, x, DIRECT\nappnexus.com, x, DIRECT\ngoogle.com, y, RESELLER\n")}
 	svc := NewService(mc, ff, 1*time.Minute)
-	res1, err := svc.Analyze(ctx, "msn.com")
+	res1, err := svc.Analyze(ctx, "msn.com", models.AnalyzeOptions{})
 	if err != nil {
 		t.Fatalf("analyze1 err: %v", err)
 	}
@@ -46,7 +51,10 @@ func TestService_Analyze_CachesResult(t *testing.T) {
 	if res1.Cached {
 		t.Fatalf("first call should not be cached")
 	}
-	res2, err := svc.Analyze(ctx, "https://msn.com/ads.txt")
+	if len(res1.Records) != 3 || res1.TotalAdvertisers != 3 {
+		t.Fatalf("records=%d total=%d want 3/3", len(res1.Records), res1.TotalAdvertisers)
+	}
+	res2, err := svc.Analyze(ctx, "https://msn.com/ads.txt", models.AnalyzeOptions{})
 	if err != nil {
 		t.Fatalf("analyze2 err: %v", err)
 	}
@@ -57,3 +65,244 @@ func TestService_Analyze_CachesResult(t *testing.T) {
 		t.Fatalf("fetcher should not be called again; calls=%d", ff.calls)
 	}
 }
+
+// TestService_Analyze_RelationshipBreakdown verifies per-advertiser DIRECT/RESELLER
+// counts, distinct account ids, cert ids, and the top-level relationship totals.
+// PASS: google.com has 2 direct / 1 reseller / 2 accounts / 1 cert id; totals 2+2.
+// FAIL: any count or total mismatch.
+func TestService_Analyze_RelationshipBreakdown(t *testing.T) {
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	ff := &fakeFetcher{data: []byte(
+		"google.com, pub-1, DIRECT, f08c47fec0942fa0\n" +
+			"google.com, pub-1, DIRECT\n" +
+			"google.com, pub-2, RESELLER, f08c47fec0942fa0\n" +
+			"appnexus.com, 7, RESELLER\n")}
+	svc := NewService(mc, ff, time.Minute)
+	res, err := svc.Analyze(context.Background(), "msn.com", models.AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("analyze err: %v", err)
+	}
+	if res.TotalDirect != 2 || res.TotalReseller != 2 {
+		t.Fatalf("totals direct=%d reseller=%d want 2/2", res.TotalDirect, res.TotalReseller)
+	}
+	g := res.Advertisers[0]
+	if g.Domain != "google.com" || g.Direct != 2 || g.Reseller != 1 || g.AccountIDs != 2 {
+		t.Fatalf("bad google breakdown: %#v", g)
+	}
+	if len(g.CertIDs) != 1 || g.CertIDs[0] != "f08c47fec0942fa0" {
+		t.Fatalf("bad cert ids: %#v", g.CertIDs)
+	}
+}
+
+// TestService_ValidateAndDiagnostics verifies that diagnostics are only returned
+// by Analyze when requested, and that Validate reuses the cached analysis.
+// PASS: no diagnostics without the option, one with it, Validate cached=true, single fetch.
+// FAIL: diagnostics leak, missing, or an extra fetch happens.
+func TestService_ValidateAndDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	ff := &fakeFetcher{data: []byte("google.com, pub-1, DIRECT\nnotadomain, x, DIRECT\n")}
+	svc := NewService(mc, ff, time.Minute)
+
+	res, err := svc.Analyze(ctx, "msn.com", models.AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("analyze err: %v", err)
+	}
+	if len(res.Diagnostics) != 0 || res.Validation.Errors != 1 {
+		t.Fatalf("diagnostics=%d errors=%d", len(res.Diagnostics), res.Validation.Errors)
+	}
+	res, _ = svc.Analyze(ctx, "msn.com", models.AnalyzeOptions{IncludeDiagnostics: true})
+	if len(res.Diagnostics) != 1 || res.Diagnostics[0].Code != CodeDomainNoDot {
+		t.Fatalf("want one domain_no_dot diagnostic: %#v", res.Diagnostics)
+	}
+	rep, err := svc.Validate(ctx, "msn.com", models.KindAdsTxt)
+	if err != nil {
+		t.Fatalf("validate err: %v", err)
+	}
+	if !rep.Cached || rep.Summary.Valid || len(rep.Diagnostics) != 1 {
+		t.Fatalf("bad report: %#v", rep)
+	}
+	if ff.calls != 1 {
+		t.Fatalf("fetcher calls=%d want 1", ff.calls)
+	}
+}
+
+// TestService_Analyze_IDN verifies that Unicode and punycode spellings of a
+// publisher share one cache entry and that seller domains are canonicalized.
+// PASS: second spelling is cached; both forms returned; the two seller spellings
+// collapse into one advertiser with its Unicode form.
+// FAIL: second fetch, missing forms or split advertisers.
+func TestService_Analyze_IDN(t *testing.T) {
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	ff := &fakeFetcher{data: []byte("bücher.de, 1, DIRECT\nxn--bcher-kva.de, 2, RESELLER\n")}
+	svc := NewService(mc, ff, time.Minute)
+	ctx := context.Background()
+	res, err := svc.Analyze(ctx, "Bücher.de", models.AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("analyze err: %v", err)
+	}
+	if res.Domain != "xn--bcher-kva.de" || res.DomainUnicode != "bücher.de" {
+		t.Fatalf("domain forms %q / %q", res.Domain, res.DomainUnicode)
+	}
+	if len(res.Advertisers) != 1 || res.Advertisers[0].Domain != "xn--bcher-kva.de" ||
+		res.Advertisers[0].DomainUnicode != "bücher.de" || res.Advertisers[0].Count != 2 {
+		t.Fatalf("advertisers %#v", res.Advertisers)
+	}
+	res, err = svc.Analyze(ctx, "xn--bcher-kva.de", models.AnalyzeOptions{})
+	if err != nil || !res.Cached || ff.calls != 1 {
+		t.Fatalf("punycode spelling not cached: cached=%v calls=%d err=%v", res.Cached, ff.calls, err)
+	}
+}
+
+// TestService_Analyze_MergesWWW verifies that www.<domain> and <domain>
+// share one cache entry and that the requested spelling reaches the fetcher.
+// PASS: the www request fetches once as www.example.com and is reported as
+// example.com; the bare request is served from cache. Without MergeWWW the
+// spellings stay separate.
+// FAIL: a second fetch, wrong domain, or wrong host handed to the fetcher.
+func TestService_Analyze_MergesWWW(t *testing.T) {
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	ff := &hostFetcher{}
+	svc := NewServiceWithOptions(mc, ff, ServiceOptions{TTL: time.Minute, MergeWWW: true})
+	ctx := context.Background()
+
+	res, err := svc.Analyze(ctx, "WWW.Example.com", models.AnalyzeOptions{})
+	if err != nil || res.Domain != "example.com" || res.Cached || len(ff.hosts) != 1 || ff.hosts[0] != "www.example.com" {
+		t.Fatalf("www: err=%v domain=%q cached=%v hosts=%v", err, res.Domain, res.Cached, ff.hosts)
+	}
+	res, err = svc.Analyze(ctx, "example.com", models.AnalyzeOptions{})
+	if err != nil || !res.Cached || len(ff.hosts) != 1 {
+		t.Fatalf("bare: err=%v cached=%v hosts=%v", err, res.Cached, ff.hosts)
+	}
+
+	svc = NewServiceWithOptions(mc, ff, ServiceOptions{TTL: time.Minute})
+	res, err = svc.Analyze(ctx, "www.example.org", models.AnalyzeOptions{})
+	if err != nil || res.Domain != "www.example.org" {
+		t.Fatalf("unmerged: err=%v domain=%q", err, res.Domain)
+	}
+}
+
+// hostFetcher records the domains it was asked for.
+type hostFetcher struct{ hosts []string }
+
+func (f *hostFetcher) GetAdsTxt(ctx context.Context, req FetchRequest) (*FetchResult, error) {
+	f.hosts = append(f.hosts, req.Domain)
+	return &FetchResult{Body: []byte("google.com, 1, DIRECT\n"), Info: models.FetchInfo{Host: req.Domain}}, nil
+}
+
+// TestService_Analyze_PersistsProvenance verifies that fetch provenance is
+// returned and survives the cache round-trip.
+// PASS: both the fresh and the cached result carry the fetcher's FetchInfo.
+// FAIL: Fetch missing or altered on either call.
+func TestService_Analyze_PersistsProvenance(t *testing.T) {
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	info := models.FetchInfo{FinalURL: "https://www.msn.com/ads.txt", Scheme: "https", Status: 200, Bytes: 22, SHA256: "abc"}
+	ff := &fakeFetcher{data: []byte("google.com, x, DIRECT\n"), info: info}
+	svc := NewService(mc, ff, time.Minute)
+	for i := 0; i < 2; i++ {
+		res, err := svc.Analyze(context.Background(), "msn.com", models.AnalyzeOptions{})
+		if err != nil {
+			t.Fatalf("analyze err: %v", err)
+		}
+		if res.Fetch == nil || res.Fetch.FinalURL != info.FinalURL || res.Fetch.SHA256 != info.SHA256 || res.Cached != (i == 1) {
+			t.Fatalf("call %d: fetch=%+v cached=%v", i, res.Fetch, res.Cached)
+		}
+	}
+}
+
+// revalFetcher serves one body with an ETag and answers 304 when the ETag is
+// presented again, unless changed is set.
+type revalFetcher struct {
+	reqs    []FetchRequest
+	changed bool
+	served  string // reported as the serving host
+}
+
+func (f *revalFetcher) GetAdsTxt(ctx context.Context, req FetchRequest) (*FetchResult, error) {
+	f.reqs = append(f.reqs, req)
+	if req.ETag == `"v1"` && !f.changed {
+		return &FetchResult{NotModified: true, Info: models.FetchInfo{Status: 304}}, nil
+	}
+	body := "google.com, 1, DIRECT\n"
+	if f.changed {
+		body += "appnexus.com, 2, DIRECT\n"
+	}
+	return &FetchResult{Body: []byte(body), Info: models.FetchInfo{Status: 200, Host: f.served, ETag: `"v1"`, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}}, nil
+}
+
+// TestService_Analyze_RevalidatesAtServingHost checks that with MergeWWW the
+// conditional request goes to the host whose response carried the
+// validators, not to the spelling the caller used.
+// PASS: the revalidation request is for www.example.com and carries the ETag.
+// FAIL: the validators are sent to the bare host.
+func TestService_Analyze_RevalidatesAtServingHost(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Hour, AutoJanitor: false, Now: clock})
+	defer mc.Close()
+	ff := &revalFetcher{served: "www.example.com"}
+	svc := NewServiceWithOptions(mc, ff, ServiceOptions{TTL: time.Minute, RevalidateWindow: time.Hour, Now: clock, MergeWWW: true})
+	ctx := context.Background()
+
+	if _, err := svc.Analyze(ctx, "example.com", models.AnalyzeOptions{}); err != nil {
+		t.Fatalf("first: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := svc.Analyze(ctx, "example.com", models.AnalyzeOptions{}); err != nil || len(ff.reqs) != 2 {
+		t.Fatalf("revalidate: err=%v reqs=%+v", err, ff.reqs)
+	}
+	if r := ff.reqs[1]; r.Domain != "www.example.com" || r.ETag != `"v1"` {
+		t.Fatalf("conditional request sent to the wrong host: %+v", r)
+	}
+}
+
+// TestService_Analyze_Revalidates verifies that an expired entry with
+// validators is revalidated with a conditional request, extended on 304 and
+// replaced when the file changed.
+// PASS: fresh entry served without fetching; after expiry If-None-Match/If-Modified-Since
+// are sent, a 304 yields the cached result and a new freshness period, and a 200 re-parses.
+// FAIL: unconditional re-fetch, re-parse on 304 or stale data after a change.
+func TestService_Analyze_Revalidates(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Hour, AutoJanitor: false, Now: clock})
+	defer mc.Close()
+	ff := &revalFetcher{}
+	svc := NewServiceWithOptions(mc, ff, ServiceOptions{TTL: time.Minute, RevalidateWindow: time.Hour, Now: clock})
+	ctx := context.Background()
+
+	first, err := svc.Analyze(ctx, "msn.com", models.AnalyzeOptions{})
+	if err != nil || first.Cached || len(ff.reqs) != 1 || ff.reqs[0].ETag != "" {
+		t.Fatalf("first: err=%v cached=%v reqs=%+v", err, first.Cached, ff.reqs)
+	}
+	now = now.Add(30 * time.Second)
+	if res, _ := svc.Analyze(ctx, "msn.com", models.AnalyzeOptions{}); !res.Cached || len(ff.reqs) != 1 {
+		t.Fatalf("fresh entry should be served from cache; reqs=%d", len(ff.reqs))
+	}
+
+	now = now.Add(2 * time.Minute)
+	res, err := svc.Analyze(ctx, "msn.com", models.AnalyzeOptions{})
+	if err != nil || !res.Cached || len(ff.reqs) != 2 || !res.Timestamp.Equal(first.Timestamp) {
+		t.Fatalf("304: err=%v cached=%v reqs=%d", err, res.Cached, len(ff.reqs))
+	}
+	if r := ff.reqs[1]; r.ETag != `"v1"` || r.LastModified == "" {
+		t.Fatalf("conditional request missing validators: %+v", r)
+	}
+	now = now.Add(30 * time.Second)
+	_, _ = svc.Analyze(ctx, "msn.com", models.AnalyzeOptions{})
+	if len(ff.reqs) != 2 {
+		t.Fatalf("304 should extend freshness; reqs=%d", len(ff.reqs))
+	}
+
+	ff.changed = true
+	now = now.Add(2 * time.Minute)
+	res, err = svc.Analyze(ctx, "msn.com", models.AnalyzeOptions{})
+	if err != nil || res.Cached || res.TotalAdvertisers != 2 || len(ff.reqs) != 3 {
+		t.Fatalf("changed: err=%v cached=%v total=%d reqs=%d", err, res.Cached, res.TotalAdvertisers, len(ff.reqs))
+	}
+}
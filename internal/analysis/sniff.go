@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Reasons carried by InvalidContentError.
+const (
+	InvalidHTML   = "html"   // soft-404 or other web page
+	InvalidGzip   = "gzip"   // compressed body without Content-Encoding
+	InvalidBinary = "binary" // images, archives and other non-text data
+)
+
+// InvalidContentError reports a 200 response whose body is not an
+// ads.txt-style text file, so "no file" is not mistaken for "no sellers".
+type InvalidContentError struct {
+	Reason      string
+	ContentType string
+}
+
+func (e *InvalidContentError) Error() string {
+	return fmt.Sprintf("response is not a text file (%s, content-type %q)", e.Reason, e.ContentType)
+}
+
+// sniffLen is how much of the body is inspected, as in http.DetectContentType.
+const sniffLen = 1024
+
+// markupTags betray an HTML page anywhere near the top of the body.
+var markupTags = [][]byte{
+	[]byte("<!doctype"), []byte("<html"), []byte("<head"), []byte("<body"),
+	[]byte("<script"), []byte("<meta"), []byte("<title"), []byte("<div"),
+}
+
+// sniffText returns an Invalid* reason when body (served as contentType) is
+// not a plain-text file, or "" when it looks fine. Empty bodies are valid.
+// The Content-Type alone is not trusted: plenty of servers label good files
+// text/html or application/octet-stream, so it only lowers the bar for
+// recognizing markup.
+func sniffText(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	head := body
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	if len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b {
+		return InvalidGzip
+	}
+
+	detected := http.DetectContentType(head)
+	if strings.HasPrefix(detected, "text/html") || strings.HasPrefix(detected, "text/xml") {
+		return InvalidHTML
+	}
+	lower := bytes.ToLower(head)
+	tags := 0
+	for _, t := range markupTags {
+		if bytes.Contains(lower, t) {
+			tags++
+		}
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if tags >= 2 || tags == 1 && (mt == "text/html" || mt == "application/xhtml+xml") {
+		return InvalidHTML
+	}
+
+	if !strings.HasPrefix(detected, "text/") && !isUTF16Charset(contentType) {
+		return InvalidBinary
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package analysis
+
+import "testing"
+
+// TestSniffText classifies typical soft-404, binary and valid responses.
+// PASS: each body maps to its expected reason ("" for valid files).
+// FAIL: a valid file is rejected or an invalid one accepted.
+func TestSniffText(t *testing.T) {
+	cases := []struct {
+		name, ct, body, want string
+	}{
+		{"plain", "text/plain", "google.com, pub-1, DIRECT\n", ""},
+		{"empty", "text/html", "", ""},
+		{"mislabelled html", "text/html", "# ads.txt\ngoogle.com, pub-1, DIRECT\n", ""},
+		{"octet-stream", "application/octet-stream", "google.com, pub-1, DIRECT\n", ""},
+		{"utf-16 bom", "text/plain", "\xff\xfeg\x00o\x00", ""},
+		{"utf-16 charset", "text/plain; charset=utf-16le", "g\x00o\x00", ""},
+		{"doctype", "text/plain", "<!DOCTYPE html><html><body>Not found</body></html>", InvalidHTML},
+		{"late markup", "text/html", "\n\n  Page not found <div class=x>", InvalidHTML},
+		{"two tags", "", "oops\n<head><title>404</title></head>", InvalidHTML},
+		{"gzip", "text/plain", "\x1f\x8b\x08\x00\x00\x00", InvalidGzip},
+		{"png", "image/png", "\x89PNG\r\n\x1a\n\x00\x00", InvalidBinary},
+		{"nul bytes", "text/plain", "google.com\x00\x01\x02", InvalidBinary},
+	}
+	for _, c := range cases {
+		if got := sniffText(c.ct, []byte(c.body)); got != c.want {
+			t.Fatalf("%s: got %q want %q", c.name, got, c.want)
+		}
+	}
+}
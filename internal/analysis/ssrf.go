@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+
+	"github.com/avivbaron/ads-analyzer/internal/metrics"
+)
+
+// blockedRange is a destination network the fetcher never connects to.
+type blockedRange struct {
+	prefix netip.Prefix
+	name   string // metric label and BlockedError.Range
+}
+
+var blockedRanges = func() []blockedRange {
+	list := []struct{ cidr, name string }{
+		{"0.0.0.0/8", "unspecified"},
+		{"10.0.0.0/8", "private"},
+		{"100.64.0.0/10", "private"}, // carrier-grade NAT
+		{"127.0.0.0/8", "loopback"},
+		{"169.254.169.254/32", "metadata"},
+		{"169.254.0.0/16", "link_local"},
+		{"172.16.0.0/12", "private"},
+		{"192.0.0.0/24", "reserved"},
+		{"192.168.0.0/16", "private"},
+		{"198.18.0.0/15", "reserved"},
+		{"224.0.0.0/4", "multicast"},
+		{"240.0.0.0/4", "reserved"}, // includes 255.255.255.255
+		{"::/128", "unspecified"},
+		{"::1/128", "loopback"},
+		{"fd00:ec2::254/128", "metadata"},
+		{"fc00::/7", "private"},
+		{"fe80::/10", "link_local"},
+		{"ff00::/8", "multicast"},
+	}
+	out := make([]blockedRange, 0, len(list))
+	for _, r := range list {
+		out = append(out, blockedRange{prefix: netip.MustParsePrefix(r.cidr), name: r.name})
+	}
+	return out
+}()
+
+// BlockedError is returned when a fetch (or one of its redirects) would
+// connect to a non-public address.
+type BlockedError struct {
+	Addr  netip.Addr
+	Range string // loopback, private, link_local, metadata, multicast, ...
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("destination %s is not allowed (%s)", e.Addr, e.Range)
+}
+
+// blockedRangeOf returns the name of the blocked range containing addr,
+// or "" when addr is public or inside an allow prefix.
+func blockedRangeOf(addr netip.Addr, allow []netip.Prefix) string {
+	addr = addr.Unmap()
+	for _, p := range allow {
+		if p.Contains(addr) {
+			return ""
+		}
+	}
+	for _, r := range blockedRanges {
+		if r.prefix.Contains(addr) {
+			return r.name
+		}
+	}
+	return ""
+}
+
+// dialGuard returns a net.Dialer Control hook that vets the resolved address
+// of every connection, so DNS rebinding and redirects cannot reach internal
+// hosts.
+func dialGuard(allow []netip.Prefix) func(network, address string, _ syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return err
+		}
+		if rng := blockedRangeOf(addr, allow); rng != "" {
+			metrics.IncFetchBlocked(rng)
+			return &BlockedError{Addr: addr.Unmap(), Range: rng}
+		}
+		return nil
+	}
+}
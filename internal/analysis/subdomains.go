@@ -0,0 +1,79 @@
+package analysis
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/avivbaron/ads-analyzer/internal/models"
+	"github.com/avivbaron/ads-analyzer/internal/util"
+)
+
+// followSubdomains analyzes the files referenced by parent's SUBDOMAIN
+// directives, up to s.maxSubdomains per file and s.maxSubdomainDepth levels.
+// Each child goes through s.analyze, so it is cached under its own key.
+// visited guards against loops and is only touched by the calling goroutine;
+// with MergeWWW it is keyed like the cache, so www.<visited> is skipped too.
+func (s *Service) followSubdomains(ctx context.Context, parent models.AnalysisResult, depth int, visited map[string]bool) []models.AnalysisResult {
+	if depth > s.maxSubdomainDepth {
+		return nil
+	}
+
+	var subs []string
+	for _, raw := range parent.Variables.Subdomain {
+		sub, err := util.NormalizeDomain(raw)
+		if err != nil {
+			continue
+		}
+		key := sub
+		if s.mergeWWW {
+			key = util.StripWWW(sub)
+		}
+		if visited[key] {
+			continue
+		}
+		// the spec only allows subdomains of the file's own domain
+		if !strings.HasSuffix(sub, "."+parent.Domain) {
+			continue
+		}
+		visited[key] = true
+		subs = append(subs, sub)
+		if len(subs) == s.maxSubdomains {
+			break
+		}
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	out := make([]models.AnalysisResult, len(subs))
+	var wg sync.WaitGroup
+	for i, sub := range subs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.analyze(ctx, sub, parent.Kind)
+			if err != nil {
+				res = models.AnalysisResult{Domain: sub, DomainUnicode: util.ToUnicode(sub), Kind: parent.Kind, Error: err.Error()}
+			}
+			out[i] = res
+		}()
+	}
+	wg.Wait()
+
+	for i := range out {
+		if out[i].Error == "" {
+			out[i].Subdomains = s.followSubdomains(ctx, out[i], depth+1, visited)
+		}
+	}
+	return out
+}
+
+// treeRecords returns the records of res and all of its subdomains.
+func treeRecords(res models.AnalysisResult) []models.AdsTxtRecord {
+	recs := append([]models.AdsTxtRecord(nil), res.Records...)
+	for _, sub := range res.Subdomains {
+		recs = append(recs, treeRecords(sub)...)
+	}
+	return recs
+}
@@ -0,0 +1,102 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/cache"
+	"github.com/avivbaron/ads-analyzer/internal/models"
+)
+
+// mapFetcher serves a different ads.txt body per domain.
+type mapFetcher struct {
+	mu    sync.Mutex
+	files map[string]string
+	calls map[string]int
+}
+
+func (f *mapFetcher) GetAdsTxt(ctx context.Context, req FetchRequest) (*FetchResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[req.Domain]++
+	body, ok := f.files[req.Domain]
+	if !ok {
+		return nil, fmt.Errorf("no ads.txt for %s", req.Domain)
+	}
+	return &FetchResult{Body: []byte(body)}, nil
+}
+
+// TestService_FollowSubdomains verifies that SUBDOMAIN directives are followed
+// within the root domain only, capped by fan-out, cached per child, and merged.
+// PASS: one child analyzed (foreign + over-cap entries skipped), merged counts include it,
+// and a second call serves the child from cache.
+// FAIL: wrong tree shape, merged counts, or extra fetches.
+func TestService_FollowSubdomains(t *testing.T) {
+	ctx := context.Background()
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	mf := &mapFetcher{files: map[string]string{
+		"example.com":        "subdomain=sports.example.com\nsubdomain=evil.com\nsubdomain=news.example.com\ngoogle.com, pub-1, DIRECT\n",
+		"sports.example.com": "google.com, pub-2, DIRECT\nappnexus.com, 1, RESELLER\n",
+		"news.example.com":   "openx.com, 9, DIRECT\n",
+	}}
+	svc := NewServiceWithOptions(mc, mf, ServiceOptions{TTL: time.Minute, MaxSubdomains: 1, MaxSubdomainDepth: 1})
+
+	res, err := svc.Analyze(ctx, "example.com", models.AnalyzeOptions{FollowSubdomains: true})
+	if err != nil {
+		t.Fatalf("analyze err: %v", err)
+	}
+	if len(res.Subdomains) != 1 || res.Subdomains[0].Domain != "sports.example.com" {
+		t.Fatalf("bad subdomains: %#v", res.Subdomains)
+	}
+	if len(res.MergedAdvertisers) != 2 || res.MergedAdvertisers[0].Domain != "google.com" || res.MergedAdvertisers[0].Count != 2 {
+		t.Fatalf("bad merged: %#v", res.MergedAdvertisers)
+	}
+	if mf.calls["evil.com"] != 0 || mf.calls["news.example.com"] != 0 {
+		t.Fatalf("unexpected fetches: %#v", mf.calls)
+	}
+
+	plain, _ := svc.Analyze(ctx, "example.com", models.AnalyzeOptions{})
+	if len(plain.Subdomains) != 0 || len(plain.MergedAdvertisers) != 0 {
+		t.Fatalf("subdomains returned without the option")
+	}
+	if _, err := svc.Analyze(ctx, "example.com", models.AnalyzeOptions{FollowSubdomains: true}); err != nil {
+		t.Fatalf("analyze2 err: %v", err)
+	}
+	if mf.calls["example.com"] != 1 || mf.calls["sports.example.com"] != 1 {
+		t.Fatalf("children should be cached: %#v", mf.calls)
+	}
+}
+
+// TestService_FollowSubdomains_SkipsWWWOfVisited checks that with MergeWWW a
+// SUBDOMAIN entry for the www host of an already visited domain is skipped,
+// since it shares that domain's cache entry.
+// PASS: only sports.example.com is followed and google.com is counted once per file.
+// FAIL: the root comes back as its own subdomain and is counted twice.
+func TestService_FollowSubdomains_SkipsWWWOfVisited(t *testing.T) {
+	ctx := context.Background()
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	mf := &mapFetcher{files: map[string]string{
+		"example.com":        "subdomain=www.example.com\nsubdomain=sports.example.com\ngoogle.com, pub-1, DIRECT\n",
+		"sports.example.com": "google.com, pub-2, DIRECT\n",
+	}}
+	svc := NewServiceWithOptions(mc, mf, ServiceOptions{TTL: time.Minute, MaxSubdomains: 5, MaxSubdomainDepth: 2, MergeWWW: true})
+
+	res, err := svc.Analyze(ctx, "example.com", models.AnalyzeOptions{FollowSubdomains: true})
+	if err != nil {
+		t.Fatalf("analyze err: %v", err)
+	}
+	if len(res.Subdomains) != 1 || res.Subdomains[0].Domain != "sports.example.com" {
+		t.Fatalf("bad subdomains: %#v", res.Subdomains)
+	}
+	if len(res.MergedAdvertisers) != 1 || res.MergedAdvertisers[0].Count != 2 {
+		t.Fatalf("bad merged: %#v", res.MergedAdvertisers)
+	}
+}
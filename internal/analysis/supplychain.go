@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/avivbaron/ads-analyzer/internal/models"
+)
+
+type SupplyChainOptions struct {
+	MaxDepth int // intermediary hops below the ads.txt ad systems; 0 => default
+	MaxNodes int // total sellers.json files visited; 0 => default
+	Workers  int // concurrent sellers.json lookups; 0 => default
+}
+
+func (o SupplyChainOptions) withDefaults() SupplyChainOptions {
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = 3
+	}
+	if o.MaxNodes <= 0 {
+		o.MaxNodes = 200
+	}
+	if o.Workers <= 0 {
+		o.Workers = sellersCheckWorkers
+	}
+	return o
+}
+
+// supplyHop is a node waiting to be expanded. ids restricts which sellers.json
+// entries are followed (the RESELLER account ids at depth 0); nil means all.
+type supplyHop struct {
+	domain string
+	ids    map[string]bool
+}
+
+// SupplyChain walks the sellers.json graph starting at the ad systems of the
+// RESELLER records. Each level's files are loaded concurrently (and cached by
+// index); INTERMEDIARY/BOTH entries with a domain become the next level.
+// Edges back to an ancestor are flagged as cycles and not expanded again.
+func (s *SellersService) SupplyChain(ctx context.Context, records []models.AdsTxtRecord, opt SupplyChainOptions) models.SupplyGraph {
+	opt = opt.withDefaults()
+	g := models.SupplyGraph{Nodes: []models.SupplyNode{}, Edges: []models.SupplyEdge{}}
+
+	// parent remembers how each node was first reached, for cycle detection.
+	parent := make(map[string]string)
+	nodeIdx := make(map[string]int)
+
+	var level []supplyHop
+	roots := make(map[string]*supplyHop)
+	for _, r := range records {
+		if r.Relationship != models.RelationshipReseller || r.AccountID == "" {
+			continue
+		}
+		h, ok := roots[r.Domain]
+		if !ok {
+			if len(roots) == opt.MaxNodes {
+				g.Truncated = true
+				continue
+			}
+			h = &supplyHop{domain: r.Domain, ids: make(map[string]bool)}
+			roots[r.Domain] = h
+			nodeIdx[r.Domain] = len(g.Nodes)
+			g.Nodes = append(g.Nodes, models.SupplyNode{Domain: r.Domain, Depth: 0})
+			level = append(level, supplyHop{domain: r.Domain, ids: h.ids})
+		}
+		h.ids[strings.ToLower(r.AccountID)] = true
+	}
+
+	for depth := 0; len(level) > 0; depth++ {
+		files := s.loadLevel(ctx, level, opt.Workers)
+		var next []supplyHop
+		for i, hop := range level {
+			n := &g.Nodes[nodeIdx[hop.domain]]
+			f := files[i]
+			if f.err != nil {
+				n.Status = models.SupplyNodeUnavailable
+				n.Error = f.err.Error()
+				continue
+			}
+			n.Status = models.SupplyNodeOK
+			n.Sellers = f.idx.Stats.TotalSellers
+			if depth > g.MaxDepth {
+				g.MaxDepth = depth
+			}
+
+			for _, sl := range f.idx.Intermediaries {
+				if sl.Domain == hop.domain {
+					continue
+				}
+				if hop.ids != nil && !hop.ids[strings.ToLower(sl.ID)] {
+					continue
+				}
+				e := models.SupplyEdge{From: hop.domain, To: sl.Domain, SellerID: sl.ID, SellerType: sl.Type}
+				if _, seen := nodeIdx[sl.Domain]; seen {
+					if isAncestor(parent, sl.Domain, hop.domain) {
+						e.Cycle = true
+						g.Cycles++
+					}
+					g.Edges = append(g.Edges, e)
+					continue
+				}
+				if depth+1 > opt.MaxDepth || len(g.Nodes) >= opt.MaxNodes {
+					g.Truncated = true
+					continue
+				}
+				g.Edges = append(g.Edges, e)
+				parent[sl.Domain] = hop.domain
+				nodeIdx[sl.Domain] = len(g.Nodes)
+				g.Nodes = append(g.Nodes, models.SupplyNode{Domain: sl.Domain, Depth: depth + 1})
+				next = append(next, supplyHop{domain: sl.Domain})
+			}
+		}
+		level = next
+	}
+	return g
+}
+
+// isAncestor reports whether anc is node itself or reachable by following
+// first-discovery parents up from node.
+func isAncestor(parent map[string]string, anc, node string) bool {
+	for cur, ok := node, true; ok; cur, ok = parent[cur] {
+		if cur == anc {
+			return true
+		}
+	}
+	return false
+}
+
+type supplyFile struct {
+	idx sellersIndex
+	err error
+}
+
+// loadLevel fetches the sellers.json of every hop with at most workers in flight.
+func (s *SellersService) loadLevel(ctx context.Context, level []supplyHop, workers int) []supplyFile {
+	out := make([]supplyFile, len(level))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i, hop := range level {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			idx, err := s.index(ctx, hop.domain)
+			out[i] = supplyFile{idx: idx, err: err}
+		}()
+	}
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,53 @@
+package analysis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/cache"
+	"github.com/avivbaron/ads-analyzer/internal/models"
+)
+
+// TestSellersService_SupplyChain walks ssp.com -> mid.com -> back.com -> mid.com and
+// verifies nodes, depth, the cycle flag, and that only the RESELLER account is followed.
+// PASS: 3 nodes, max depth 2, one cycle edge, other.com (not our seller id) ignored,
+// missing.com reported unavailable at depth 0 when referenced.
+// FAIL: wrong graph shape.
+func TestSellersService_SupplyChain(t *testing.T) {
+	ctx := context.Background()
+	mc := cache.NewMemory(cache.MemoryOptions{TTL: time.Minute, AutoJanitor: false, Now: time.Now})
+	defer mc.Close()
+	sf := &fakeSellersFetcher{files: map[string]string{
+		"ssp.com": `{"sellers":[
+			{"seller_id":"r-1","seller_type":"INTERMEDIARY","domain":"mid.com"},
+			{"seller_id":"r-2","seller_type":"INTERMEDIARY","domain":"other.com"}]}`,
+		"mid.com":  `{"sellers":[{"seller_id":"m-1","seller_type":"BOTH","domain":"back.com"},{"seller_id":"p","seller_type":"PUBLISHER","domain":"pub.com"}]}`,
+		"back.com": `{"sellers":[{"seller_id":"b-1","seller_type":"INTERMEDIARY","domain":"mid.com"}]}`,
+	}}
+	ss := NewSellersService(mc, sf, time.Hour)
+	recs := ParseAdsTxtRecords([]byte("ssp.com, r-1, RESELLER\nssp.com, d-1, DIRECT\nmissing.com, x, RESELLER\n"))
+
+	g := ss.SupplyChain(ctx, recs, SupplyChainOptions{MaxDepth: 5})
+	byDomain := map[string]models.SupplyNode{}
+	for _, n := range g.Nodes {
+		byDomain[n.Domain] = n
+	}
+	if len(g.Nodes) != 4 || byDomain["back.com"].Depth != 2 || g.MaxDepth != 2 {
+		t.Fatalf("bad nodes: %#v", g.Nodes)
+	}
+	if _, ok := byDomain["other.com"]; ok {
+		t.Fatalf("other.com is not the publisher's seller id and must not be followed")
+	}
+	if byDomain["missing.com"].Status != models.SupplyNodeUnavailable {
+		t.Fatalf("missing.com should be unavailable: %#v", byDomain["missing.com"])
+	}
+	if g.Cycles != 1 || g.Truncated {
+		t.Fatalf("cycles=%d truncated=%v edges=%#v", g.Cycles, g.Truncated, g.Edges)
+	}
+
+	g = ss.SupplyChain(ctx, recs, SupplyChainOptions{MaxDepth: 1})
+	if !g.Truncated || g.MaxDepth != 1 {
+		t.Fatalf("depth cap: truncated=%v max=%d", g.Truncated, g.MaxDepth)
+	}
+}
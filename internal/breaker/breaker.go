@@ -0,0 +1,267 @@
+// Package breaker implements a per-host circuit breaker for outbound fetches.
+// State lives in a cache.Cache, so replicas sharing the Redis backend also
+// share breaker state; with the memory backend it is per process.
+//
+// Only the stored state is shared. Transitions are a plain read-modify-write
+// serialized by in-process locks, not by the store, so across replicas they
+// are best-effort: concurrent failures may be undercounted, and each replica
+// may let its own probe through when a cooldown ends.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/cache"
+	"github.com/avivbaron/ads-analyzer/internal/metrics"
+)
+
+type State string
+
+const (
+	Closed   State = "closed"    // requests flow; consecutive failures are counted
+	Open     State = "open"      // requests fail fast until RetryAt
+	HalfOpen State = "half_open" // one probe is in flight; others fail fast
+)
+
+var ErrOpen = errors.New("circuit open")
+
+// OpenError is returned by Allow while the host's circuit is open.
+type OpenError struct {
+	Host       string
+	State      State
+	RetryAfter time.Duration // until the next probe is allowed
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s (retry in %s)", e.Host, e.RetryAfter.Round(time.Second))
+}
+
+func (e *OpenError) Unwrap() error { return ErrOpen }
+
+// Status is the stored state of one host's circuit.
+type Status struct {
+	Host     string    `json:"host"`
+	State    State     `json:"state"`
+	Failures int       `json:"failures"` // consecutive failures
+	Since    time.Time `json:"since"`    // last state change
+	// RetryAt is when an open circuit admits a probe, or when a half-open
+	// probe is considered lost and another one is admitted.
+	RetryAt time.Time `json:"retry_at,omitzero"`
+}
+
+type Options struct {
+	Threshold    int           // consecutive failures that open the circuit; 0 => 5
+	Cooldown     time.Duration // time open before a probe; 0 => 1m
+	ProbeTimeout time.Duration // time a half-open probe may take; 0 => 30s
+	StateTTL     time.Duration // idle state expiry; 0 => 24h, never below Cooldown+ProbeTimeout
+	Now          func() time.Time
+}
+
+type Breaker struct {
+	store        cache.Cache
+	threshold    int
+	cooldown     time.Duration
+	probeTimeout time.Duration
+	stateTTL     time.Duration
+	now          func() time.Time
+
+	locks [64]sync.Mutex // striped by host, serializes read-modify-write in this process only
+
+	mu    sync.Mutex
+	known map[string]State // hosts with state written by this process, for List and circuit_state
+}
+
+func New(store cache.Cache, opt Options) *Breaker {
+	if opt.Threshold <= 0 {
+		opt.Threshold = 5
+	}
+	if opt.Cooldown <= 0 {
+		opt.Cooldown = time.Minute
+	}
+	if opt.ProbeTimeout <= 0 {
+		opt.ProbeTimeout = 30 * time.Second
+	}
+	if opt.StateTTL <= 0 {
+		opt.StateTTL = 24 * time.Hour
+	}
+	opt.StateTTL = max(opt.StateTTL, opt.Cooldown+opt.ProbeTimeout)
+	if opt.Now == nil {
+		opt.Now = time.Now
+	}
+	return &Breaker{
+		store:        store,
+		threshold:    opt.Threshold,
+		cooldown:     opt.Cooldown,
+		probeTimeout: opt.ProbeTimeout,
+		stateTTL:     opt.StateTTL,
+		now:          opt.Now,
+		known:        make(map[string]State),
+	}
+}
+
+// Allow reports whether a request to host may proceed. An open circuit whose
+// cooldown has passed turns half-open and admits the caller as its probe.
+func (b *Breaker) Allow(ctx context.Context, host string) error {
+	l := b.lock(host)
+	l.Lock()
+	defer l.Unlock()
+
+	st, ok := b.load(ctx, host)
+	if !ok {
+		b.untrack(host)
+		return nil
+	}
+	if st.State == Closed {
+		return nil
+	}
+	now := b.now()
+	if now.Before(st.RetryAt) {
+		metrics.IncCircuitRejected(string(st.State))
+		return &OpenError{Host: host, State: st.State, RetryAfter: st.RetryAt.Sub(now)}
+	}
+	if st.State == Open {
+		st.State, st.Since = HalfOpen, now
+		metrics.IncCircuitTransition(string(HalfOpen))
+	}
+	st.RetryAt = now.Add(b.probeTimeout)
+	b.save(ctx, st)
+	return nil
+}
+
+// Success closes host's circuit.
+func (b *Breaker) Success(ctx context.Context, host string) {
+	l := b.lock(host)
+	l.Lock()
+	defer l.Unlock()
+
+	st, ok := b.load(ctx, host)
+	if !ok {
+		b.untrack(host) // expired from the store
+		return
+	}
+	if st.State != Closed {
+		metrics.IncCircuitTransition(string(Closed))
+	}
+	b.forget(ctx, host)
+}
+
+// Failure counts a failed request to host, opening the circuit at the
+// threshold or straight away when a half-open probe fails.
+func (b *Breaker) Failure(ctx context.Context, host string) {
+	l := b.lock(host)
+	l.Lock()
+	defer l.Unlock()
+
+	now := b.now()
+	st, ok := b.load(ctx, host)
+	if !ok {
+		st = Status{Host: host, State: Closed, Since: now}
+	}
+	st.Failures++
+	switch {
+	case st.State == Open:
+		// a request admitted before the circuit opened; keep the cooldown
+	case st.State == HalfOpen || st.Failures >= b.threshold:
+		st.State, st.Since, st.RetryAt = Open, now, now.Add(b.cooldown)
+		metrics.IncCircuitTransition(string(Open))
+	}
+	b.save(ctx, st)
+}
+
+// Status returns host's circuit; hosts without state are closed.
+func (b *Breaker) Status(ctx context.Context, host string) (Status, error) {
+	var st Status
+	hit, err := b.store.Get(ctx, key(host), &st)
+	if err != nil {
+		return Status{}, err
+	}
+	if !hit {
+		return Status{Host: host, State: Closed}, nil
+	}
+	return st, nil
+}
+
+// List returns the circuits with state that this process has written,
+// sorted by host. The host index is per replica: with a shared store,
+// circuits written only by other replicas are not listed, though Status
+// still reports them.
+func (b *Breaker) List(ctx context.Context) []Status {
+	b.mu.Lock()
+	hosts := make([]string, 0, len(b.known))
+	for h := range b.known {
+		hosts = append(hosts, h)
+	}
+	b.mu.Unlock()
+	sort.Strings(hosts)
+
+	out := make([]Status, 0, len(hosts))
+	for _, h := range hosts {
+		if st, ok := b.load(ctx, h); ok {
+			out = append(out, st)
+		} else {
+			b.untrack(h)
+		}
+	}
+	return out
+}
+
+// Reset closes host's circuit and clears its failure count.
+func (b *Breaker) Reset(ctx context.Context, host string) error {
+	l := b.lock(host)
+	l.Lock()
+	defer l.Unlock()
+
+	b.untrack(host)
+	return b.store.Delete(ctx, key(host))
+}
+
+func (b *Breaker) lock(host string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(host))
+	return &b.locks[h.Sum32()%uint32(len(b.locks))]
+}
+
+// load reads host's state; store errors count as no state so an
+// unavailable store never blocks fetches.
+func (b *Breaker) load(ctx context.Context, host string) (Status, bool) {
+	var st Status
+	hit, err := b.store.Get(ctx, key(host), &st)
+	return st, hit && err == nil
+}
+
+func (b *Breaker) save(ctx context.Context, st Status) {
+	_ = b.store.Set(ctx, key(st.Host), st, b.stateTTL)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if prev, ok := b.known[st.Host]; ok {
+		if prev == st.State {
+			return
+		}
+		metrics.AddCircuitState(string(prev), -1)
+	}
+	b.known[st.Host] = st.State
+	metrics.AddCircuitState(string(st.State), 1)
+}
+
+func (b *Breaker) forget(ctx context.Context, host string) {
+	_ = b.store.Delete(ctx, key(host))
+	b.untrack(host)
+}
+
+// untrack drops host from the known index and the circuit_state gauge.
+func (b *Breaker) untrack(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if prev, ok := b.known[host]; ok {
+		delete(b.known, host)
+		metrics.AddCircuitState(string(prev), -1)
+	}
+}
+
+func key(host string) string { return "breaker:" + host }
@@ -0,0 +1,151 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/avivbaron/ads-analyzer/internal/cache"
+	"github.com/avivbaron/ads-analyzer/internal/metrics"
+)
+
+// TestBreaker_StateMachine walks one host through closed -> open ->
+// half-open -> open -> half-open -> closed with a fake clock.
+// PASS: trips at the threshold, fails fast while open, admits exactly one
+// probe after the cooldown, reopens on probe failure and closes on success.
+// FAIL: any transition happens early, late or not at all.
+func TestBreaker_StateMachine(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	mc := cache.NewMemory(cache.MemoryOptions{Now: clock})
+	defer mc.Close()
+	b := New(mc, Options{Threshold: 3, Cooldown: time.Minute, ProbeTimeout: 10 * time.Second, Now: clock})
+	ctx := context.Background()
+	const host = "slow.example"
+
+	for i := 0; i < 2; i++ {
+		b.Failure(ctx, host)
+		if err := b.Allow(ctx, host); err != nil {
+			t.Fatalf("failure %d: want closed, got %v", i+1, err)
+		}
+	}
+	b.Failure(ctx, host)
+	err := b.Allow(ctx, host)
+	var oe *OpenError
+	if !errors.As(err, &oe) || !errors.Is(err, ErrOpen) || oe.RetryAfter != time.Minute {
+		t.Fatalf("want open for 1m, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Allow(ctx, host); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := b.Allow(ctx, host); !errors.As(err, &oe) || oe.State != HalfOpen {
+		t.Fatalf("second caller during probe: want half-open rejection, got %v", err)
+	}
+	b.Failure(ctx, host)
+	if st, _ := b.Status(ctx, host); st.State != Open {
+		t.Fatalf("failed probe: want open, got %+v", st)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Allow(ctx, host); err != nil {
+		t.Fatalf("probe 2: %v", err)
+	}
+	b.Success(ctx, host)
+	if st, _ := b.Status(ctx, host); st.State != Closed || st.Failures != 0 {
+		t.Fatalf("want closed, got %+v", st)
+	}
+	if got := b.List(ctx); len(got) != 0 {
+		t.Fatalf("closed hosts should not be listed: %+v", got)
+	}
+}
+
+// TestBreaker_LostProbeAndReset checks that a probe that never reports back
+// is replaced after ProbeTimeout, that success resets the consecutive
+// count, and that Reset closes an open circuit.
+// PASS: a new probe is admitted after the timeout; interleaved success keeps
+// the circuit closed; Reset makes Allow pass again.
+// FAIL: the circuit stays stuck half-open, trips early, or ignores Reset.
+func TestBreaker_LostProbeAndReset(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	mc := cache.NewMemory(cache.MemoryOptions{Now: clock})
+	defer mc.Close()
+	b := New(mc, Options{Threshold: 2, Cooldown: time.Minute, ProbeTimeout: 10 * time.Second, Now: clock})
+	ctx := context.Background()
+
+	b.Failure(ctx, "a.example")
+	b.Success(ctx, "a.example")
+	b.Failure(ctx, "a.example")
+	if err := b.Allow(ctx, "a.example"); err != nil {
+		t.Fatalf("non-consecutive failures tripped the circuit: %v", err)
+	}
+
+	b.Failure(ctx, "b.example")
+	b.Failure(ctx, "b.example")
+	now = now.Add(time.Minute)
+	if err := b.Allow(ctx, "b.example"); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	now = now.Add(10 * time.Second)
+	if err := b.Allow(ctx, "b.example"); err != nil {
+		t.Fatalf("replacement probe: %v", err)
+	}
+
+	if got := b.List(ctx); len(got) != 2 || got[0].Host != "a.example" || got[1].State != HalfOpen {
+		t.Fatalf("list: %+v", got)
+	}
+	if err := b.Reset(ctx, "b.example"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	b.Failure(ctx, "b.example")
+	if err := b.Allow(ctx, "b.example"); err != nil {
+		t.Fatalf("after reset: %v", err)
+	}
+}
+
+// TestBreaker_StateGauge checks that circuit_state follows every transition
+// and that hosts whose state expired from the store are dropped by Success.
+// PASS: gauge values match the circuits after each step and end at zero.
+// FAIL: a host is counted twice, in the wrong state, or never removed.
+func TestBreaker_StateGauge(t *testing.T) {
+	metrics.Init(true)
+	defer metrics.Init(false)
+	gauge := func(s State) float64 { return testutil.ToFloat64(metrics.M.CircuitState.WithLabelValues(string(s))) }
+
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	mc := cache.NewMemory(cache.MemoryOptions{Now: clock})
+	defer mc.Close()
+	b := New(mc, Options{Threshold: 1, Cooldown: time.Minute, ProbeTimeout: time.Second, StateTTL: time.Hour, Now: clock})
+	ctx := context.Background()
+
+	b.Failure(ctx, "a.example")
+	b.Failure(ctx, "a.example")
+	_ = b.Allow(ctx, "a.example")
+	if gauge(Open) != 1 || gauge(HalfOpen) != 0 {
+		t.Fatalf("open: got open=%v half_open=%v", gauge(Open), gauge(HalfOpen))
+	}
+	now = now.Add(time.Minute)
+	_ = b.Allow(ctx, "a.example")
+	if gauge(Open) != 0 || gauge(HalfOpen) != 1 {
+		t.Fatalf("half-open: got open=%v half_open=%v", gauge(Open), gauge(HalfOpen))
+	}
+	b.Success(ctx, "a.example")
+	if gauge(HalfOpen) != 0 || len(b.known) != 0 {
+		t.Fatalf("closed: got half_open=%v known=%v", gauge(HalfOpen), b.known)
+	}
+
+	b.Failure(ctx, "b.example")
+	_ = b.Reset(ctx, "b.example")
+	b.Failure(ctx, "c.example")
+	now = now.Add(2 * time.Hour) // c.example's state expires from the store
+	b.Success(ctx, "c.example")
+	if gauge(Open) != 0 || len(b.known) != 0 {
+		t.Fatalf("after reset and expiry: open=%v known=%v", gauge(Open), b.known)
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
@@ -9,12 +10,47 @@ import (
 )
 
 type Config struct {
-	Port         string
-	FetchTimeout time.Duration // ads.txt fetch timeout
-	HTTPFallback bool          // allow http:// fallback if https fails
+	Port          string
+	FetchTimeout  time.Duration // ads.txt fetch timeout, per attempt
+	FetchDeadline time.Duration // bound on one whole fetch: retries, schemes and host variants
+	HTTPFallback  bool          // allow http:// fallback if https fails
+	FetchMode     string        // sequential | hedged | https-only
+	HedgeDelay    time.Duration // hedged: head start of https before http is raced
+	HostVariants  string        // none | www: also try www.<domain> (or the bare domain) for ads.txt
+
+	FetchAllowCIDRs []netip.Prefix // destinations exempt from the SSRF guard
+
+	FetchMaxBytes   int64 // size cap for ads.txt bodies; larger files are truncated
+	SellersMaxBytes int64 // size cap for sellers.json bodies
+
+	FetchRetryAttempts  int           // attempts per URL on transient failures, including the first
+	FetchRetryBaseDelay time.Duration // backoff before the first retry, doubled per attempt
+	FetchRetryMaxDelay  time.Duration // backoff cap; a longer Retry-After is not waited for
+
+	FetchMaxPerHost  int // concurrent outbound requests per host; 0 => unlimited
+	FetchDomainRPS   int // outbound request starts per second per registrable domain; 0 => unlimited
+	FetchDomainBurst int // burst for FetchDomainRPS
+	FetchMaxInFlight int // concurrent outbound requests overall; 0 => unlimited
+
+	AdminToken string // bearer token for /admin/* endpoints; empty => disabled
+
+	BreakerEnabled   bool          // per-host circuit breaker in the fetch path
+	BreakerThreshold int           // consecutive failures that open a host's circuit
+	BreakerCooldown  time.Duration // time a circuit stays open before a probe
+
+	SupplyChainMaxDepth int // intermediary hops walked below ads.txt ad systems
+	SupplyChainMaxNodes int // sellers.json files visited per graph
+	SupplyChainWorkers  int // concurrent sellers.json lookups per graph
+
+	AliasFile string // optional JSON/YAML registry: SSP name -> exchange domains
+
+	SubdomainMaxFanout int // max SUBDOMAIN directives followed per file
+	SubdomainMaxDepth  int // max nesting when following SUBDOMAIN directives
 
 	CacheBackend  string        // memory|redis|file (implemented later)
 	CacheTTL      time.Duration // TTL for cached results
+	SellersTTL    time.Duration // TTL for cached sellers.json files
+	RevalidateWin time.Duration // how long expired entries with ETag/Last-Modified are kept for 304 revalidation
 	CacheMaxItems int           // 0 => unlimited (no LRU eviction)
 	CacheSweepMin time.Duration // lower bound for janitor interval
 	CacheSweepMax time.Duration // upper bound for janitor interval
@@ -39,12 +75,45 @@ type Config struct {
 
 func Load() (Config, error) {
 	c := Config{
-		Port:         getenv("PORT", "8080"),
-		FetchTimeout: getDurationEnv("FETCH_TIMEOUT", "5s"),
-		HTTPFallback: getBoolEnv("HTTP_FALLBACK", true),
+		Port:          getenv("PORT", "8080"),
+		FetchTimeout:  getDurationEnv("FETCH_TIMEOUT", "5s"),
+		FetchDeadline: getDurationEnv("FETCH_DEADLINE", "8s"),
+		HTTPFallback:  getBoolEnv("HTTP_FALLBACK", true),
+		FetchMode:     getenv("FETCH_MODE", "sequential"),
+		HedgeDelay:    getDurationEnv("FETCH_HEDGE_DELAY", "1s"),
+		HostVariants:  getenv("FETCH_HOST_VARIANTS", "www"),
+
+		FetchMaxBytes:   int64(getIntEnv("FETCH_MAX_BYTES", 16<<20)),
+		SellersMaxBytes: int64(getIntEnv("SELLERS_MAX_BYTES", 64<<20)),
+
+		FetchRetryAttempts:  getIntEnv("FETCH_RETRY_ATTEMPTS", 3),
+		FetchRetryBaseDelay: getDurationEnv("FETCH_RETRY_BASE_DELAY", "200ms"),
+		FetchRetryMaxDelay:  getDurationEnv("FETCH_RETRY_MAX_DELAY", "5s"),
+
+		FetchMaxPerHost:  getIntEnv("FETCH_MAX_PER_HOST", 4),
+		FetchDomainRPS:   getIntEnv("FETCH_DOMAIN_RPS", 10),
+		FetchDomainBurst: getIntEnv("FETCH_DOMAIN_BURST", 20),
+		FetchMaxInFlight: getIntEnv("FETCH_MAX_INFLIGHT", 128),
+
+		AdminToken: getenv("ADMIN_TOKEN", ""),
+
+		BreakerEnabled:   getBoolEnv("BREAKER_ENABLED", true),
+		BreakerThreshold: getIntEnv("BREAKER_THRESHOLD", 5),
+		BreakerCooldown:  getDurationEnv("BREAKER_COOLDOWN", "1m"),
+
+		SupplyChainMaxDepth: getIntEnv("SUPPLY_CHAIN_MAX_DEPTH", 3),
+		SupplyChainMaxNodes: getIntEnv("SUPPLY_CHAIN_MAX_NODES", 200),
+		SupplyChainWorkers:  getIntEnv("SUPPLY_CHAIN_WORKERS", 8),
+
+		AliasFile: getenv("ALIAS_FILE", ""),
+
+		SubdomainMaxFanout: getIntEnv("SUBDOMAIN_MAX_FANOUT", 10),
+		SubdomainMaxDepth:  getIntEnv("SUBDOMAIN_MAX_DEPTH", 1),
 
 		CacheBackend:  strings.ToLower(getenv("CACHE_BACKEND", "memory")),
 		CacheTTL:      getDurationEnv("CACHE_TTL", "10m"),
+		SellersTTL:    getDurationEnv("SELLERS_CACHE_TTL", "6h"),
+		RevalidateWin: getDurationEnv("CACHE_REVALIDATE_WINDOW", "48h"),
 		CacheMaxItems: getIntEnv("CACHE_MAX_ITEMS", 0),
 		CacheSweepMin: getDurationEnv("CACHE_SWEEP_MIN", "1s"),
 		CacheSweepMax: getDurationEnv("CACHE_SWEEP_MAX", "5m"),
@@ -68,7 +137,23 @@ func Load() (Config, error) {
 		MetricsEnabled: getBoolEnv("METRICS_ENABLED", true),
 	}
 
+	allow, err := parseCIDRs(getenv("FETCH_ALLOW_CIDRS", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid FETCH_ALLOW_CIDRS: %w", err)
+	}
+	c.FetchAllowCIDRs = allow
+
 	// Basic sanity checks
+	switch c.FetchMode {
+	case "sequential", "hedged", "https-only":
+	default:
+		return Config{}, fmt.Errorf("invalid FETCH_MODE: %s", c.FetchMode)
+	}
+	switch c.HostVariants {
+	case "none", "www":
+	default:
+		return Config{}, fmt.Errorf("invalid FETCH_HOST_VARIANTS: %s", c.HostVariants)
+	}
 	switch c.CacheBackend {
 	case "memory", "redis", "file":
 	default:
@@ -80,9 +165,24 @@ func Load() (Config, error) {
 	if c.RateBurst < c.RatePerSec {
 		c.RateBurst = c.RatePerSec
 	}
+	if c.FetchRetryAttempts <= 0 {
+		c.FetchRetryAttempts = 1
+	}
+	if c.FetchRetryMaxDelay < c.FetchRetryBaseDelay {
+		c.FetchRetryMaxDelay = c.FetchRetryBaseDelay
+	}
+	if c.BreakerThreshold <= 0 {
+		c.BreakerThreshold = 1
+	}
 	if c.BatchWorkers <= 0 {
 		c.BatchWorkers = 1
 	}
+	if c.SubdomainMaxFanout <= 0 {
+		c.SubdomainMaxFanout = 1
+	}
+	if c.SubdomainMaxDepth <= 0 {
+		c.SubdomainMaxDepth = 1
+	}
 	if c.CacheSweepMin <= 0 {
 		c.CacheSweepMin = time.Second
 	}
@@ -125,3 +225,29 @@ func getIntEnv(env string, def int) int {
 	}
 	return def
 }
+
+// parseCIDRs parses a comma-separated list of CIDRs; bare IPs are taken as
+// single-address prefixes.
+func parseCIDRs(v string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !strings.Contains(f, "/") {
+			a, err := netip.ParseAddr(f)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, netip.PrefixFrom(a, a.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
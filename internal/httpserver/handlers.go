@@ -4,11 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/avivbaron/ads-analyzer/internal/analysis"
+	"github.com/avivbaron/ads-analyzer/internal/breaker"
 	"github.com/avivbaron/ads-analyzer/internal/buildinfo"
 	"github.com/avivbaron/ads-analyzer/internal/models"
 	"github.com/avivbaron/ads-analyzer/internal/util"
@@ -17,11 +22,36 @@ import (
 // Analyzer is the minimal interface our handlers need.
 // analysis.Service satisfies this automatically.
 type Analyzer interface {
-	Analyze(ctx context.Context, domain string) (models.AnalysisResult, error)
+	Analyze(ctx context.Context, domain string, opts models.AnalyzeOptions) (models.AnalysisResult, error)
+}
+
+// Validator produces ads.txt lint reports; analysis.Service satisfies it.
+type Validator interface {
+	Validate(ctx context.Context, domain string, kind models.FileKind) (models.ValidationReport, error)
+}
+
+// SellersAnalyzer summarizes sellers.json files; analysis.SellersService satisfies it.
+type SellersAnalyzer interface {
+	Stats(ctx context.Context, domain string) (models.SellersStats, error)
+}
+
+// SChainValidator validates OpenRTB supply chains; analysis.Service satisfies it.
+type SChainValidator interface {
+	ValidateSChain(ctx context.Context, req models.SChainValidateRequest) (models.SChainReport, error)
+}
+
+// BreakerAdmin inspects and resets per-host circuits; breaker.Breaker satisfies it.
+type BreakerAdmin interface {
+	Status(ctx context.Context, host string) (breaker.Status, error)
+	List(ctx context.Context) []breaker.Status
+	Reset(ctx context.Context, host string) error
 }
 
 type Handler struct {
 	analyzer     Analyzer
+	validator    Validator
+	sellers      SellersAnalyzer
+	schain       SChainValidator
 	batchWorkers int
 }
 
@@ -32,15 +62,34 @@ func NewHandler(a Analyzer, batchWorkers int) *Handler {
 	return &Handler{analyzer: a, batchWorkers: batchWorkers}
 }
 
-// GET /api/analysis?domain=...
+// GET /api/analysis?domain=...[&type=ads|app-ads][&diagnostics=true][&subdomains=true][&sellers=true][&supply_chain=true]
+// [&group=raw|registrable|alias]
 func (h *Handler) handleAnalysis(w http.ResponseWriter, r *http.Request) {
 	domain := r.URL.Query().Get("domain")
 	if domain == "" {
 		writeError(w, http.StatusBadRequest, "missing domain parameter")
 		return
 	}
+	kind, err := models.ParseFileKind(r.URL.Query().Get("type"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid type parameter")
+		return
+	}
+	group, err := models.ParseGrouping(r.URL.Query().Get("group"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid group parameter")
+		return
+	}
+	opts := models.AnalyzeOptions{
+		Kind:               kind,
+		IncludeDiagnostics: queryBool(r, "diagnostics"),
+		FollowSubdomains:   queryBool(r, "subdomains"),
+		CheckSellers:       queryBool(r, "sellers"),
+		SupplyChain:        queryBool(r, "supply_chain"),
+		Group:              group,
+	}
 	ctx := r.Context()
-	res, err := h.analyzer.Analyze(ctx, domain)
+	res, err := h.analyzer.Analyze(ctx, domain, opts)
 	if err != nil {
 		writeAnalyzeErr(w, err)
 		return
@@ -48,19 +97,113 @@ func (h *Handler) handleAnalysis(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, res)
 }
 
+// GET /api/validate?domain=...[&type=ads|app-ads]
+func (h *Handler) handleValidate(w http.ResponseWriter, r *http.Request) {
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		writeError(w, http.StatusBadRequest, "missing domain parameter")
+		return
+	}
+	kind, err := models.ParseFileKind(r.URL.Query().Get("type"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid type parameter")
+		return
+	}
+	rep, err := h.validator.Validate(r.Context(), domain, kind)
+	if err != nil {
+		writeAnalyzeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// GET /api/sellers?domain=<ad system>
+func (h *Handler) handleSellers(w http.ResponseWriter, r *http.Request) {
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		writeError(w, http.StatusBadRequest, "missing domain parameter")
+		return
+	}
+	st, err := h.sellers.Stats(r.Context(), domain)
+	if err != nil {
+		writeSellersErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// POST /api/schain/validate
+// {"domain":"publisher.com","schain":{"complete":1,"ver":"1.0","nodes":[{"asi":"ssp.com","sid":"123","hp":1}]}}
+func (h *Handler) handleSChainValidate(w http.ResponseWriter, r *http.Request) {
+	var req models.SChainValidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Domain == "" {
+		writeError(w, http.StatusBadRequest, "missing domain")
+		return
+	}
+	if len(req.SChain.Nodes) == 0 {
+		writeError(w, http.StatusBadRequest, "schain has no nodes")
+		return
+	}
+	for i, n := range req.SChain.Nodes {
+		if strings.TrimSpace(n.ASI) == "" || strings.TrimSpace(n.SID) == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("node %d is missing asi or sid", i))
+			return
+		}
+	}
+	rep, err := h.schain.ValidateSChain(r.Context(), req)
+	if err != nil {
+		writeAnalyzeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
+
 // POST /api/batch-analysis
-// {"domains":["msn.com","cnn.com"]}
+// {"domains":["msn.com","cnn.com"],"type":"ads","items":[{"domain":"x.com","type":"app-ads"}],"follow_subdomains":false}
 func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
 	var req models.BatchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
 		return
 	}
-	if len(req.Domains) == 0 {
+	if len(req.Domains) == 0 && len(req.Items) == 0 {
 		writeError(w, http.StatusBadRequest, "domains list is empty")
 		return
 	}
 
+	// Flatten domains + items into one ordered list with resolved kinds.
+	defKind, err := models.ParseFileKind(req.Type)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid type")
+		return
+	}
+	group, err := models.ParseGrouping(req.Group)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid group")
+		return
+	}
+	domains := make([]string, 0, len(req.Domains)+len(req.Items))
+	kinds := make([]models.FileKind, 0, cap(domains))
+	for _, d := range req.Domains {
+		domains = append(domains, d)
+		kinds = append(kinds, defKind)
+	}
+	for i, it := range req.Items {
+		k := defKind
+		if it.Type != "" {
+			if k, err = models.ParseFileKind(it.Type); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid type for item %d", i))
+				return
+			}
+		}
+		domains = append(domains, it.Domain)
+		kinds = append(kinds, k)
+	}
+
 	ctx := r.Context()
 	type item struct {
 		idx int
@@ -68,7 +211,7 @@ func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
 		err error
 	}
 
-	workers := min(h.batchWorkers, len(req.Domains))
+	workers := min(h.batchWorkers, len(domains))
 
 	jobs := make(chan int)
 	out := make(chan item)
@@ -88,7 +231,14 @@ func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			res, err := h.analyzer.Analyze(ctx, req.Domains[idx])
+			opts := models.AnalyzeOptions{
+				Kind:             kinds[idx],
+				FollowSubdomains: req.FollowSubdomains,
+				CheckSellers:     req.CheckSellers,
+				SupplyChain:      req.SupplyChain,
+				Group:            group,
+			}
+			res, err := h.analyzer.Analyze(ctx, domains[idx], opts)
 
 			select {
 			case out <- item{idx: idx, res: res, err: err}:
@@ -104,7 +254,7 @@ func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	go func() {
-		for i := range req.Domains {
+		for i := range domains {
 			select {
 			case jobs <- i:
 			case <-ctx.Done():
@@ -118,12 +268,12 @@ func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
 		close(out)
 	}()
 
-	results := make([]models.AnalysisResult, len(req.Domains))
+	results := make([]models.AnalysisResult, len(domains))
 	for it := range out {
 		if it.err != nil {
 			// Represent errors as zero-result placeholder with timestamp
-			d := req.Domains[it.idx]
-			results[it.idx] = models.AnalysisResult{Domain: d, TotalAdvertisers: 0, Advertisers: nil, Cached: false, Timestamp: time.Now().UTC()}
+			d := domains[it.idx]
+			results[it.idx] = models.AnalysisResult{Domain: d, Kind: kinds[it.idx], TotalAdvertisers: 0, Advertisers: nil, Cached: false, Timestamp: time.Now().UTC()}
 			continue
 		}
 		results[it.idx] = it.res
@@ -132,6 +282,15 @@ func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, models.BatchResponse{Results: results})
 }
 
+// queryBool reports whether query parameter name is set to a truthy value.
+func queryBool(r *http.Request, name string) bool {
+	switch strings.ToLower(r.URL.Query().Get(name)) {
+	case "1", "true", "yes", "y":
+		return true
+	}
+	return false
+}
+
 func writeJSON(w http.ResponseWriter, code int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -142,19 +301,60 @@ func writeError(w http.ResponseWriter, code int, msg string) {
 	writeJSON(w, code, map[string]any{"error": msg})
 }
 
+// writeErrorCode is writeError plus a machine-readable reason code.
+func writeErrorCode(w http.ResponseWriter, status int, msg, code string) {
+	writeJSON(w, status, map[string]any{"error": msg, "code": code})
+}
+
 func writeAnalyzeErr(w http.ResponseWriter, err error) {
+	var de *util.DomainError
 	switch {
+	case errors.As(err, &de):
+		writeErrorCode(w, http.StatusBadRequest, "invalid domain", de.Reason)
+		return
 	case errors.Is(err, util.ErrBadDomain):
 		writeError(w, http.StatusBadRequest, "invalid domain")
 		return
+	case errors.Is(err, models.ErrBadKind):
+		writeError(w, http.StatusBadRequest, "invalid type")
+		return
+	case errors.Is(err, analysis.ErrNoSellers):
+		writeErrorCode(w, http.StatusNotImplemented, "sellers.json lookups are not configured", "sellers_not_configured")
+		return
 	}
 	var se *analysis.StatusError
 	if errors.As(err, &se) {
-		if se.Code == http.StatusNotFound {
+		if se.Code == http.StatusNotFound || se.Code == http.StatusGone {
 			writeError(w, http.StatusNotFound, "ads.txt not found")
 			return
 		}
 	}
+	var be *analysis.BlockedError
+	if errors.As(err, &be) {
+		writeError(w, http.StatusForbidden, "destination not allowed")
+		return
+	}
+	var re *analysis.RedirectError
+	if errors.As(err, &re) {
+		writeErrorCode(w, http.StatusBadGateway, "redirect not allowed by the ads.txt policy", "redirect_not_allowed")
+		return
+	}
+	var ic *analysis.InvalidContentError
+	if errors.As(err, &ic) {
+		writeErrorCode(w, http.StatusUnprocessableEntity, "invalid ads.txt ("+ic.Reason+")", "invalid_ads_txt")
+		return
+	}
+	var oe *breaker.OpenError
+	if errors.As(err, &oe) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(oe.RetryAfter.Seconds()))))
+		writeErrorCode(w, http.StatusServiceUnavailable, "origin temporarily unavailable", "circuit_open")
+		return
+	}
+	var tl *analysis.TooLargeError
+	if errors.As(err, &tl) {
+		writeError(w, http.StatusBadGateway, "response too large")
+		return
+	}
 	if errors.Is(err, context.DeadlineExceeded) {
 		writeError(w, http.StatusGatewayTimeout, "fetch timeout")
 		return
@@ -162,6 +362,69 @@ func writeAnalyzeErr(w http.ResponseWriter, err error) {
 	writeError(w, http.StatusBadGateway, err.Error())
 }
 
+// writeSellersErr is writeAnalyzeErr for sellers.json lookups: errors that
+// name the file are reported for sellers.json, the rest are shared.
+func writeSellersErr(w http.ResponseWriter, err error) {
+	var se *analysis.StatusError
+	if errors.As(err, &se) && (se.Code == http.StatusNotFound || se.Code == http.StatusGone) {
+		writeError(w, http.StatusNotFound, "sellers.json not found")
+		return
+	}
+	if errors.Is(err, analysis.ErrInvalidSellersJSON) {
+		writeErrorCode(w, http.StatusUnprocessableEntity, "invalid sellers.json", "invalid_sellers_json")
+		return
+	}
+	var re *analysis.RedirectError
+	if errors.As(err, &re) {
+		writeErrorCode(w, http.StatusBadGateway, "redirect not allowed for sellers.json", "redirect_not_allowed")
+		return
+	}
+	writeAnalyzeErr(w, err)
+}
+
+// GET    /admin/breakers             => circuits whose state this replica wrote (not other replicas')
+// GET    /admin/breakers?host=<host> => one circuit (closed if unknown)
+// DELETE /admin/breakers?host=<host> => reset to closed
+func HandleBreakers(b BreakerAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.URL.Query().Get("host")
+		if host != "" {
+			h, err := util.NormalizeDomain(host)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid host")
+				return
+			}
+			host = h
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if host == "" {
+				writeJSON(w, http.StatusOK, map[string]any{"breakers": b.List(r.Context())})
+				return
+			}
+			st, err := b.Status(r.Context(), host)
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, st)
+		case http.MethodDelete:
+			if host == "" {
+				writeError(w, http.StatusBadRequest, "missing host parameter")
+				return
+			}
+			if err := b.Reset(r.Context(), host); err != nil {
+				writeError(w, http.StatusBadGateway, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, breaker.Status{Host: host, State: breaker.Closed})
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
 // Readiness: verify cache roundtrip quickly
 func HandleReady(deps Deps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
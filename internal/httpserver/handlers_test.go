@@ -4,14 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
-	"time"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/avivbaron/ads-analyzer/internal/analysis"
+	"github.com/avivbaron/ads-analyzer/internal/breaker"
+	"github.com/avivbaron/ads-analyzer/internal/cache"
 	"github.com/avivbaron/ads-analyzer/internal/models"
 	"github.com/avivbaron/ads-analyzer/internal/util"
 )
@@ -20,7 +25,7 @@ type fakeAnalyzer struct{
 	calls atomic.Int64 
 }
 
-func (f *fakeAnalyzer) Analyze(ctx context.Context, domain string) (models.AnalysisResult, error) {
+func (f *fakeAnalyzer) Analyze(ctx context.Context, domain string, opts models.AnalyzeOptions) (models.AnalysisResult, error) {
 	f.calls.Add(1)
 	return models.AnalysisResult{Domain: "msn.com", TotalAdvertisers: 3, Advertisers: []models.AdvertiserCount{{Domain: "google.com", Count: 2}, {Domain: "appnexus.com", Count: 1}}, Cached: false, Timestamp: time.Unix(0, 0).UTC()}, nil
 }
@@ -77,13 +82,13 @@ func TestHandleBatch_OK(t *testing.T) {
 
 type errAnalyzer struct{ err error }
 
-func (e *errAnalyzer) Analyze(ctx context.Context, domain string) (models.AnalysisResult, error) {
+func (e *errAnalyzer) Analyze(ctx context.Context, domain string, opts models.AnalyzeOptions) (models.AnalysisResult, error) {
 	return models.AnalysisResult{}, e.err
 }
 
 type okAnalyzer struct{}
 
-func (o *okAnalyzer) Analyze(ctx context.Context, domain string) (models.AnalysisResult, error) {
+func (o *okAnalyzer) Analyze(ctx context.Context, domain string, opts models.AnalyzeOptions) (models.AnalysisResult, error) {
 	return models.AnalysisResult{Domain: domain, Timestamp: time.Unix(0, 0).UTC()}, nil
 }
 
@@ -97,6 +102,10 @@ func TestHandleAnalysis_Errors(t *testing.T) {
 	}{
 		{util.ErrBadDomain, http.StatusBadRequest},
 		{&analysis.StatusError{Code: http.StatusNotFound}, http.StatusNotFound},
+		{&analysis.StatusError{Code: http.StatusGone}, http.StatusNotFound},
+		{analysis.ErrNoSellers, http.StatusNotImplemented},
+		{&analysis.BlockedError{Range: "loopback"}, http.StatusForbidden},
+		{fmt.Errorf("fetch: %w", &breaker.OpenError{Host: "msn.com", RetryAfter: time.Minute}), http.StatusServiceUnavailable},
 		{context.DeadlineExceeded, http.StatusGatewayTimeout},
 		{errors.New("upstream"), http.StatusBadGateway},
 	}
@@ -133,3 +142,318 @@ func TestHandleBatch_OrderAndErrors(t *testing.T) {
 		t.Fatalf("len=%d", len(out.Results))
 	}
 }
+
+type fakeValidator struct{}
+
+func (fakeValidator) Validate(ctx context.Context, domain string, kind models.FileKind) (models.ValidationReport, error) {
+	return models.ValidationReport{
+		Domain:      domain,
+		Summary:     models.ValidationSummary{Lines: 1, Errors: 1},
+		Diagnostics: []models.Diagnostic{{Line: 1, Severity: models.SeverityError, Code: "domain_no_dot", Text: "x, 1, DIRECT"}},
+	}, nil
+}
+
+// TestHandleValidate_OK ensures the validate handler returns the report and
+// rejects requests without a domain.
+// PASS: 200 with one diagnostic for a domain; 400 without one.
+// FAIL: wrong status or diagnostics missing.
+func TestHandleValidate_OK(t *testing.T) {
+	h := NewHandler(&okAnalyzer{}, 1)
+	h.validator = fakeValidator{}
+	r := httptest.NewRequest(http.MethodGet, "/api/validate?domain=msn.com", nil)
+	w := httptest.NewRecorder()
+	h.handleValidate(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+	var out models.ValidationReport
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if out.Domain != "msn.com" || len(out.Diagnostics) != 1 || out.Diagnostics[0].Code != "domain_no_dot" {
+		t.Fatalf("bad body: %#v", out)
+	}
+
+	w = httptest.NewRecorder()
+	h.handleValidate(w, httptest.NewRequest(http.MethodGet, "/api/validate", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("missing domain: status=%d", w.Code)
+	}
+}
+
+type optsAnalyzer struct{ got models.AnalyzeOptions }
+
+func (o *optsAnalyzer) Analyze(ctx context.Context, domain string, opts models.AnalyzeOptions) (models.AnalysisResult, error) {
+	o.got = opts
+	return models.AnalysisResult{Domain: domain}, nil
+}
+
+// TestHandleAnalysis_DiagnosticsOption checks that ?diagnostics=true reaches the analyzer.
+// PASS: IncludeDiagnostics is true.
+// FAIL: option not propagated.
+func TestHandleAnalysis_DiagnosticsOption(t *testing.T) {
+	oa := &optsAnalyzer{}
+	h := NewHandler(oa, 1)
+	r := httptest.NewRequest(http.MethodGet, "/api/analysis?domain=msn.com&diagnostics=true", nil)
+	w := httptest.NewRecorder()
+	h.handleAnalysis(w, r)
+	if w.Code != http.StatusOK || !oa.got.IncludeDiagnostics {
+		t.Fatalf("status=%d opts=%#v", w.Code, oa.got)
+	}
+}
+
+type kindAnalyzer struct {
+	mu    sync.Mutex
+	kinds map[string]models.FileKind
+}
+
+func (k *kindAnalyzer) Analyze(ctx context.Context, domain string, opts models.AnalyzeOptions) (models.AnalysisResult, error) {
+	k.mu.Lock()
+	k.kinds[domain] = opts.Kind
+	k.mu.Unlock()
+	return models.AnalysisResult{Domain: domain, Kind: opts.Kind}, nil
+}
+
+// TestHandleKind_QueryAndBatch checks that ?type= selects the file kind, that an
+// unknown type is rejected, and that batch items carry their own kind.
+// PASS: app-ads reaches the analyzer; bad type -> 400; batch kinds per item.
+// FAIL: wrong kind propagated or wrong status.
+func TestHandleKind_QueryAndBatch(t *testing.T) {
+	ka := &kindAnalyzer{kinds: map[string]models.FileKind{}}
+	h := NewHandler(ka, 2)
+
+	w := httptest.NewRecorder()
+	h.handleAnalysis(w, httptest.NewRequest(http.MethodGet, "/api/analysis?domain=game.com&type=app-ads", nil))
+	if w.Code != http.StatusOK || ka.kinds["game.com"] != models.KindAppAdsTxt {
+		t.Fatalf("status=%d kind=%q", w.Code, ka.kinds["game.com"])
+	}
+
+	w = httptest.NewRecorder()
+	h.handleAnalysis(w, httptest.NewRequest(http.MethodGet, "/api/analysis?domain=game.com&type=bogus", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("bad type: status=%d", w.Code)
+	}
+
+	body := `{"domains":["msn.com"],"items":[{"domain":"app.com","type":"app-ads.txt"},{"domain":"cnn.com"}]}`
+	w = httptest.NewRecorder()
+	h.handleBatch(w, httptest.NewRequest(http.MethodPost, "/api/batch-analysis", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("batch status=%d", w.Code)
+	}
+	var out models.BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(out.Results) != 3 || out.Results[1].Domain != "app.com" || out.Results[1].Kind != models.KindAppAdsTxt || out.Results[2].Kind != models.KindAdsTxt {
+		t.Fatalf("bad batch results: %#v", out.Results)
+	}
+}
+
+type fakeSellers struct{ err error }
+
+func (f fakeSellers) Stats(ctx context.Context, domain string) (models.SellersStats, error) {
+	if f.err != nil {
+		return models.SellersStats{}, f.err
+	}
+	return models.SellersStats{Domain: domain, TotalSellers: 2, ByType: map[string]int{"PUBLISHER": 2}}, nil
+}
+
+// TestHandleSellers checks the sellers stats handler and its error mapping.
+// PASS: 200 with stats; 502 for *analysis.TooLargeError; 404 naming sellers.json
+// for a missing file; 422 for an invalid one.
+// FAIL: wrong status or body.
+func TestHandleSellers(t *testing.T) {
+	h := NewHandler(&okAnalyzer{}, 1)
+	h.sellers = fakeSellers{}
+	w := httptest.NewRecorder()
+	h.handleSellers(w, httptest.NewRequest(http.MethodGet, "/api/sellers?domain=ssp.com", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+	var out models.SellersStats
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil || out.TotalSellers != 2 {
+		t.Fatalf("bad body: %v %#v", err, out)
+	}
+
+	h.sellers = fakeSellers{err: &analysis.TooLargeError{Limit: 10}}
+	w = httptest.NewRecorder()
+	h.handleSellers(w, httptest.NewRequest(http.MethodGet, "/api/sellers?domain=ssp.com", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("too large: status=%d", w.Code)
+	}
+
+	h.sellers = fakeSellers{err: fmt.Errorf("fetch: %w", &analysis.StatusError{Code: http.StatusNotFound})}
+	w = httptest.NewRecorder()
+	h.handleSellers(w, httptest.NewRequest(http.MethodGet, "/api/sellers?domain=ssp.com", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "sellers.json not found") {
+		t.Fatalf("not found: status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	h.sellers = fakeSellers{err: fmt.Errorf("%w: unexpected EOF", analysis.ErrInvalidSellersJSON)}
+	w = httptest.NewRecorder()
+	h.handleSellers(w, httptest.NewRequest(http.MethodGet, "/api/sellers?domain=ssp.com", nil))
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"invalid_sellers_json"`) {
+		t.Fatalf("invalid: status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+type fakeSChain struct{ calls int }
+
+func (f *fakeSChain) ValidateSChain(ctx context.Context, req models.SChainValidateRequest) (models.SChainReport, error) {
+	f.calls++
+	return models.SChainReport{Domain: req.Domain, Valid: true, Nodes: []models.SChainNodeVerdict{{ASI: req.SChain.Nodes[0].ASI, Valid: true}}}, nil
+}
+
+// TestHandleSChainValidate checks input validation and the happy path.
+// PASS: 400 for missing nodes / missing sid without calling the validator; 200 with report otherwise.
+// FAIL: wrong status or validator called on bad input.
+func TestHandleSChainValidate(t *testing.T) {
+	fs := &fakeSChain{}
+	h := NewHandler(&okAnalyzer{}, 1)
+	h.schain = fs
+	bad := []string{
+		`{"domain":"pub.com","schain":{"complete":1,"nodes":[]}}`,
+		`{"domain":"pub.com","schain":{"complete":1,"nodes":[{"asi":"ssp.com"}]}}`,
+		`{"schain":{"complete":1,"nodes":[{"asi":"ssp.com","sid":"1"}]}}`,
+	}
+	for _, b := range bad {
+		w := httptest.NewRecorder()
+		h.handleSChainValidate(w, httptest.NewRequest(http.MethodPost, "/api/schain/validate", strings.NewReader(b)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("body %s: status=%d", b, w.Code)
+		}
+	}
+	if fs.calls != 0 {
+		t.Fatalf("validator called on bad input")
+	}
+	w := httptest.NewRecorder()
+	body := `{"domain":"pub.com","schain":{"complete":1,"nodes":[{"asi":"ssp.com","sid":"1","hp":1}]}}`
+	h.handleSChainValidate(w, httptest.NewRequest(http.MethodPost, "/api/schain/validate", strings.NewReader(body)))
+	if w.Code != http.StatusOK || fs.calls != 1 {
+		t.Fatalf("status=%d calls=%d", w.Code, fs.calls)
+	}
+}
+
+// TestHandleAnalysis_DomainReason checks that strict-validation failures surface
+// their reason code next to the error message.
+// PASS: 400 with {"error":"invalid domain","code":"ip_literal"}.
+// FAIL: other status or missing code.
+func TestHandleAnalysis_DomainReason(t *testing.T) {
+	h := NewHandler(&errAnalyzer{err: fmt.Errorf("wrapped: %w", &util.DomainError{Reason: util.ReasonIPLiteral})}, 2)
+	r := httptest.NewRequest(http.MethodGet, "/api/analysis?domain=127.0.0.1", nil)
+	w := httptest.NewRecorder()
+	h.handleAnalysis(w, r)
+	var body map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadRequest || body["error"] != "invalid domain" || body["code"] != util.ReasonIPLiteral {
+		t.Fatalf("status=%d body=%v", w.Code, body)
+	}
+}
+
+// TestHandleAnalysis_InvalidContent checks that soft-404/binary responses get
+// their own status and code instead of a generic upstream error.
+// PASS: 422 with code "invalid_ads_txt".
+// FAIL: other status or code.
+func TestHandleAnalysis_InvalidContent(t *testing.T) {
+	h := NewHandler(&errAnalyzer{err: &analysis.InvalidContentError{Reason: analysis.InvalidHTML, ContentType: "text/html"}}, 2)
+	r := httptest.NewRequest(http.MethodGet, "/api/analysis?domain=msn.com", nil)
+	w := httptest.NewRecorder()
+	h.handleAnalysis(w, r)
+	var body map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusUnprocessableEntity || body["code"] != "invalid_ads_txt" {
+		t.Fatalf("status=%d body=%v", w.Code, body)
+	}
+}
+
+// TestHandleAnalysis_RedirectRefused checks the response for a redirect
+// refused by the ads.txt policy.
+// PASS: 502 with code redirect_not_allowed and no raw error text.
+// FAIL: generic 502 carrying the wrapped error message.
+func TestHandleAnalysis_RedirectRefused(t *testing.T) {
+	err := &url.Error{Op: "Get", URL: "https://pub.com/ads.txt", Err: &analysis.RedirectError{From: "https://host.net/ads.txt", To: "https://pub.com/x"}}
+	h := NewHandler(&errAnalyzer{err: err}, 1)
+	w := httptest.NewRecorder()
+	h.handleAnalysis(w, httptest.NewRequest(http.MethodGet, "/api/analysis?domain=pub.com", nil))
+	var body map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadGateway || body["code"] != "redirect_not_allowed" || strings.Contains(body["error"], "host.net") {
+		t.Fatalf("status=%d body=%v", w.Code, body)
+	}
+}
+
+// TestHandleBreakers checks the circuit breaker admin endpoint.
+// PASS: an opened circuit is listed and reported open, DELETE closes it,
+// bad hosts and methods are rejected.
+// FAIL: wrong status codes or state.
+func TestHandleBreakers(t *testing.T) {
+	mc := cache.NewMemory(cache.MemoryOptions{})
+	defer mc.Close()
+	b := breaker.New(mc, breaker.Options{Threshold: 1})
+	ctx := context.Background()
+	b.Failure(ctx, "example.com")
+	h := HandleBreakers(b)
+
+	do := func(method, target string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(method, target, nil))
+		var out map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+	if code, out := do(http.MethodGet, "/admin/breakers"); code != http.StatusOK || len(out["breakers"].([]any)) != 1 {
+		t.Fatalf("list: %d %v", code, out)
+	}
+	if code, out := do(http.MethodGet, "/admin/breakers?host=EXAMPLE.com"); code != http.StatusOK || out["state"] != "open" {
+		t.Fatalf("get: %d %v", code, out)
+	}
+	if code, _ := do(http.MethodDelete, "/admin/breakers?host=example.com"); code != http.StatusOK {
+		t.Fatalf("delete: %d", code)
+	}
+	if code, out := do(http.MethodGet, "/admin/breakers?host=example.com"); code != http.StatusOK || out["state"] != "closed" {
+		t.Fatalf("after reset: %d %v", code, out)
+	}
+	if code, _ := do(http.MethodGet, "/admin/breakers?host=bad..host"); code != http.StatusBadRequest {
+		t.Fatalf("bad host: %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/admin/breakers?host=example.com"); code != http.StatusMethodNotAllowed {
+		t.Fatalf("post: %d", code)
+	}
+}
+
+// TestAdminToken checks the bearer token guard in front of the admin endpoints.
+// PASS: missing or wrong tokens get 401, the right token reaches the handler.
+// FAIL: an unauthenticated request gets through or the right token is refused.
+func TestAdminToken(t *testing.T) {
+	h := mwAdminToken("s3cret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for auth, want := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"s3cret":        http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Bearer s3cret": http.StatusOK,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/admin/breakers", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Fatalf("auth %q: got %d, want %d", auth, w.Code, want)
+		}
+	}
+}
+
+// TestHandleAnalysis_CircuitOpen checks the fast-fail response of an open circuit.
+// PASS: 503 with code circuit_open and a rounded-up Retry-After.
+// FAIL: wrong status, code or header.
+func TestHandleAnalysis_CircuitOpen(t *testing.T) {
+	h := NewHandler(&errAnalyzer{err: &breaker.OpenError{Host: "msn.com", RetryAfter: 1500 * time.Millisecond}}, 1)
+	w := httptest.NewRecorder()
+	h.handleAnalysis(w, httptest.NewRequest(http.MethodGet, "/api/analysis?domain=msn.com", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" || !strings.Contains(w.Body.String(), `"circuit_open"`) {
+		t.Fatalf("got %d retry-after=%q body=%s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+}
@@ -1,8 +1,10 @@
 package httpserver
 
 import (
+	"crypto/subtle"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/avivbaron/ads-analyzer/internal/logs"
@@ -59,3 +61,19 @@ func mwAccessLog(logger zerolog.Logger) Middleware {
 		})
 	}
 }
+
+// mwAdminToken only lets requests carrying "Authorization: Bearer <token>"
+// through to next.
+func mwAdminToken(token string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
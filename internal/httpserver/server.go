@@ -15,6 +15,11 @@ import (
 type Deps struct {
 	Cache        cache.Cache
 	Analyzer     Analyzer
+	Validator    Validator       // optional; enables /api/validate
+	Sellers      SellersAnalyzer // optional; enables /api/sellers
+	SChain       SChainValidator // optional; enables /api/schain/validate
+	Breakers     BreakerAdmin    // optional; with AdminToken enables /admin/breakers
+	AdminToken   string          // bearer token for /admin/*; empty => admin endpoints off
 	BatchWorkers int
 }
 
@@ -47,6 +52,23 @@ func New(addr string, logger zerolog.Logger, limiter *ratelimit.Limiter, deps De
 		h := NewHandler(deps.Analyzer, deps.BatchWorkers)
 		mux.HandleFunc("/api/analysis", h.handleAnalysis)
 		mux.HandleFunc("/api/batch-analysis", h.handleBatch)
+		if deps.Validator != nil {
+			h.validator = deps.Validator
+			mux.HandleFunc("/api/validate", h.handleValidate)
+		}
+		if deps.Sellers != nil {
+			h.sellers = deps.Sellers
+			mux.HandleFunc("/api/sellers", h.handleSellers)
+		}
+		if deps.SChain != nil {
+			h.schain = deps.SChain
+			mux.HandleFunc("/api/schain/validate", h.handleSChainValidate)
+		}
+	}
+
+	// admin routes are opt-in and token protected
+	if deps.Breakers != nil && deps.AdminToken != "" {
+		mux.Handle("/admin/breakers", mwAdminToken(deps.AdminToken)(HandleBreakers(deps.Breakers)))
 	}
 
 	// middleware chain
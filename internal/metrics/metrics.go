@@ -16,6 +16,12 @@ type Metrics struct {
 	CacheMisses     *prometheus.CounterVec
 	FetchDuration   *prometheus.HistogramVec
 	RateLimitBlocks *prometheus.CounterVec
+	FetchBlocked    *prometheus.CounterVec
+	Revalidations   *prometheus.CounterVec
+	FetchAttempts   *prometheus.CounterVec
+	CircuitChanges  *prometheus.CounterVec
+	CircuitRejected *prometheus.CounterVec
+	CircuitState    *prometheus.GaugeVec
 }
 
 var M *Metrics
@@ -34,8 +40,14 @@ func Init(enabled bool) *Metrics {
 		CacheMisses:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "cache_misses_total", Help: "Cache misses"}, []string{"op"}),
 		FetchDuration:   prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "fetch_duration_seconds", Help: "ads.txt fetch duration", Buckets: prometheus.DefBuckets}, []string{"scheme"}),
 		RateLimitBlocks: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rate_limit_blocks_total", Help: "Requests blocked by rate limiter"}, []string{"path"}), // NEW
+		FetchBlocked:    prometheus.NewCounterVec(prometheus.CounterOpts{Name: "fetch_blocked_total", Help: "Outbound connections refused by the SSRF guard"}, []string{"range"}),
+		Revalidations:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "cache_revalidations_total", Help: "Conditional re-fetches of expired cache entries"}, []string{"result"}),
+		FetchAttempts:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "fetch_attempts_total", Help: "Outbound fetch attempts by outcome"}, []string{"scheme", "result"}),
+		CircuitChanges:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "circuit_transitions_total", Help: "Per-host circuit breaker state changes"}, []string{"state"}),
+		CircuitRejected: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "circuit_rejected_total", Help: "Fetches failed fast by an open circuit"}, []string{"state"}),
+		CircuitState:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "circuit_state", Help: "Hosts with circuit state written by this replica, by state"}, []string{"state"}),
 	}
-	r.MustRegister(m.HTTPRequests, m.HTTPDuration, m.CacheHits, m.CacheMisses, m.FetchDuration, m.RateLimitBlocks)
+	r.MustRegister(m.HTTPRequests, m.HTTPDuration, m.CacheHits, m.CacheMisses, m.FetchDuration, m.RateLimitBlocks, m.FetchBlocked, m.Revalidations, m.FetchAttempts, m.CircuitChanges, m.CircuitRejected, m.CircuitState)
 	M = m
 	return m
 }
@@ -68,3 +80,46 @@ func IncRateLimited(path string) {
 		M.RateLimitBlocks.WithLabelValues(path).Inc()
 	}
 }
+
+func IncFetchBlocked(rng string) {
+	if M != nil {
+		M.FetchBlocked.WithLabelValues(rng).Inc()
+	}
+}
+
+// IncRevalidation counts a conditional re-fetch; result is "not_modified"
+// (304, entry extended) or "modified" (full body re-parsed).
+func IncRevalidation(result string) {
+	if M != nil {
+		M.Revalidations.WithLabelValues(result).Inc()
+	}
+}
+
+// IncFetchAttempt counts one outbound GET; result is "ok", "transient"
+// (retryable failure), "permanent" or "canceled" (caller gone or hedge lost).
+func IncFetchAttempt(scheme, result string) {
+	if M != nil {
+		M.FetchAttempts.WithLabelValues(scheme, result).Inc()
+	}
+}
+
+// IncCircuitTransition counts a circuit entering state (open, half_open, closed).
+func IncCircuitTransition(state string) {
+	if M != nil {
+		M.CircuitChanges.WithLabelValues(state).Inc()
+	}
+}
+
+// IncCircuitRejected counts a fetch refused while a circuit was in state.
+func IncCircuitRejected(state string) {
+	if M != nil {
+		M.CircuitRejected.WithLabelValues(state).Inc()
+	}
+}
+
+// AddCircuitState moves the number of hosts whose circuit is in state by delta.
+func AddCircuitState(state string, delta float64) {
+	if M != nil {
+		M.CircuitState.WithLabelValues(state).Add(delta)
+	}
+}
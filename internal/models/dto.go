@@ -1,22 +1,225 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// FileKind selects which authorized-sellers file is analyzed.
+type FileKind string
+
+const (
+	KindAdsTxt    FileKind = "ads.txt"     // websites
+	KindAppAdsTxt FileKind = "app-ads.txt" // mobile and CTV apps
+)
+
+var ErrBadKind = errors.New("invalid file kind")
+
+// ParseFileKind accepts "ads", "ads.txt", "app-ads" and "app-ads.txt"
+// (case-insensitive); an empty string means ads.txt.
+func ParseFileKind(s string) (FileKind, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "ads", "ads.txt":
+		return KindAdsTxt, nil
+	case "app-ads", "app-ads.txt":
+		return KindAppAdsTxt, nil
+	}
+	return "", ErrBadKind
+}
+
+// Path is the well-known URL path of the file, e.g. "/app-ads.txt".
+func (k FileKind) Path() string {
+	if k == "" {
+		return "/" + string(KindAdsTxt)
+	}
+	return "/" + string(k)
+}
+
+// AdsTxtRecord is one data record of an ads.txt file:
+// <seller domain>, <account id>, <relationship>[, <cert authority id>].
+type AdsTxtRecord struct {
+	Domain       string `json:"domain"`
+	AccountID    string `json:"account_id"`
+	Relationship string `json:"relationship"`
+	CertID       string `json:"cert_id,omitempty"`
+	Line         int    `json:"line"`
+	Raw          string `json:"raw"`
+}
+
+// Relationship values defined by the ads.txt spec.
+const (
+	RelationshipDirect   = "DIRECT"
+	RelationshipReseller = "RESELLER"
+)
 
 type AdvertiserCount struct {
-	Domain string `json:"domain"`
-	Count  int    `json:"count"`
+	Domain            string   `json:"domain"`
+	DomainUnicode     string   `json:"domain_unicode,omitempty"`     // only when Domain is punycode
+	RegistrableDomain string   `json:"registrable_domain,omitempty"` // eTLD+1 of Domain
+	Count             int      `json:"count"`
+	Direct            int      `json:"direct"`
+	Reseller          int      `json:"reseller"`
+	AccountIDs        int      `json:"account_ids"`        // distinct publisher account ids
+	CertIDs           []string `json:"cert_ids,omitempty"` // distinct certification authority ids
 }
 
 type AnalysisResult struct {
-	Domain           string            `json:"domain"`
+	Domain           string            `json:"domain"`         // ASCII (punycode) form
+	DomainUnicode    string            `json:"domain_unicode"` // Unicode form of Domain
+	Kind             FileKind          `json:"kind"`
 	TotalAdvertisers int               `json:"total_advertisers"`
+	TotalDirect      int               `json:"total_direct"`
+	TotalReseller    int               `json:"total_reseller"`
 	Advertisers      []AdvertiserCount `json:"advertisers"`
-	Cached           bool              `json:"cached"`
-	Timestamp        time.Time         `json:"timestamp"`
+	// GroupedAdvertisers is only set when AnalyzeOptions.Group is not raw.
+	GroupedAdvertisers []AdvertiserGroup `json:"grouped_advertisers,omitempty"`
+	Records            []AdsTxtRecord    `json:"records"`
+	Variables          Variables         `json:"variables"`
+	Validation         ValidationSummary `json:"validation"`
+	Diagnostics        []Diagnostic      `json:"diagnostics,omitempty"` // only with AnalyzeOptions.IncludeDiagnostics
+	Subdomains         []AnalysisResult  `json:"subdomains,omitempty"`  // only with AnalyzeOptions.FollowSubdomains
+	// MergedAdvertisers aggregates the root and every followed subdomain.
+	MergedAdvertisers []AdvertiserCount `json:"merged_advertisers,omitempty"`
+	Error             string            `json:"error,omitempty"`         // set on subdomain results that failed
+	SellersCheck      *SellersCheck     `json:"sellers_check,omitempty"` // only with AnalyzeOptions.CheckSellers
+	SupplyChain       *SupplyGraph      `json:"supply_chain,omitempty"`  // only with AnalyzeOptions.SupplyChain
+	Fetch             *FetchInfo        `json:"fetch,omitempty"`         // how the file was retrieved
+	Cached            bool              `json:"cached"`
+	Timestamp         time.Time         `json:"timestamp"`
+}
+
+// Redirect is one hop of the redirect chain followed while fetching a file.
+type Redirect struct {
+	URL      string `json:"url"`
+	Status   int    `json:"status"`
+	Location string `json:"location"`
+}
+
+// FetchInfo records where a file came from and how it was retrieved.
+type FetchInfo struct {
+	Host         string     `json:"host,omitempty"` // host the file was requested from: the domain or its www. variant
+	FinalURL     string     `json:"final_url"`
+	Scheme       string     `json:"scheme"`   // scheme the body was served over: https or http
+	Fallback     bool       `json:"fallback"` // served by the http:// fallback
+	Mode         string     `json:"mode"`     // sequential, hedged or https-only
+	Hedged       bool       `json:"hedged"`   // http:// was raced against a slow or failed https://
+	Status       int        `json:"status"`
+	Bytes        int64      `json:"bytes"`
+	ContentType  string     `json:"content_type,omitempty"`
+	DurationMS   int64      `json:"duration_ms"` // request start to body fully read, all hops
+	SHA256       string     `json:"sha256"`      // hex digest of the body
+	Truncated    bool       `json:"truncated"`   // body exceeded the size cap and was cut at the last full line
+	ETag         string     `json:"etag,omitempty"`
+	LastModified string     `json:"last_modified,omitempty"`
+	Redirects    []Redirect `json:"redirects,omitempty"`
+	OffDomain    bool       `json:"off_domain"` // final location is outside the domain's root (eTLD+1)
+}
+
+// Variables holds the ads.txt 1.1 variable directives (name=value lines).
+// MANAGERDOMAIN may carry an optional ",CC" country suffix, kept verbatim.
+type Variables struct {
+	Contact                []string            `json:"contact,omitempty"`
+	Subdomain              []string            `json:"subdomain,omitempty"`
+	InventoryPartnerDomain []string            `json:"inventory_partner_domain,omitempty"`
+	OwnerDomain            string              `json:"owner_domain,omitempty"`
+	ManagerDomain          []string            `json:"manager_domain,omitempty"`
+	Other                  map[string][]string `json:"other,omitempty"` // unknown variables, keyed by lower-cased name
+}
+
+// Grouping selects how advertisers are grouped in AnalysisResult.GroupedAdvertisers.
+type Grouping string
+
+const (
+	GroupRaw         Grouping = "raw"         // no grouping (default)
+	GroupRegistrable Grouping = "registrable" // by eTLD+1
+	GroupAlias       Grouping = "alias"       // by alias registry name, else eTLD+1
+)
+
+var ErrBadGrouping = errors.New("invalid grouping")
+
+// ParseGrouping accepts "", "raw", "registrable" and "alias".
+func ParseGrouping(s string) (Grouping, error) {
+	switch g := Grouping(strings.ToLower(strings.TrimSpace(s))); g {
+	case "":
+		return GroupRaw, nil
+	case GroupRaw, GroupRegistrable, GroupAlias:
+		return g, nil
+	}
+	return "", ErrBadGrouping
+}
+
+// AdvertiserGroup aggregates advertisers that belong to the same company.
+type AdvertiserGroup struct {
+	Name     string   `json:"name"`
+	Count    int      `json:"count"`
+	Direct   int      `json:"direct"`
+	Reseller int      `json:"reseller"`
+	Domains  []string `json:"domains"`
+}
+
+// AnalyzeOptions tunes a single analysis.
+type AnalyzeOptions struct {
+	Kind               FileKind // ads.txt (default) or app-ads.txt
+	IncludeDiagnostics bool     // return per-line diagnostics with the result
+	FollowSubdomains   bool     // analyze files referenced by SUBDOMAIN directives
+	CheckSellers       bool     // cross-check records against each ad system's sellers.json
+	SupplyChain        bool     // walk sellers.json through INTERMEDIARY sellers of RESELLER lines
+	Group              Grouping // also return advertisers grouped by company
+}
+
+// Diagnostic severities.
+const (
+	SeverityError   = "error"   // line was ignored
+	SeverityWarning = "warning" // line was used but does not follow the spec
+	SeverityInfo    = "info"    // file-level note, not counted as a problem
+)
+
+// Diagnostic describes a problem with a single ads.txt line.
+type Diagnostic struct {
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Text     string `json:"text"`
+}
+
+type ValidationSummary struct {
+	Encoding   string `json:"encoding"` // source text encoding, e.g. "utf-8" or "utf-16le (bom)"
+	Lines      int    `json:"lines"`
+	Records    int    `json:"records"`
+	Directives int    `json:"directives"`
+	Comments   int    `json:"comments"`
+	Errors     int    `json:"errors"`
+	Warnings   int    `json:"warnings"`
+	Valid      bool   `json:"valid"`               // no errors (warnings allowed)
+	Truncated  bool   `json:"truncated,omitempty"` // file was cut at the fetch size limit
+}
+
+type ValidationReport struct {
+	Domain        string            `json:"domain"`
+	DomainUnicode string            `json:"domain_unicode"`
+	Kind          FileKind          `json:"kind"`
+	Summary       ValidationSummary `json:"summary"`
+	Diagnostics   []Diagnostic      `json:"diagnostics"`
+	Cached        bool              `json:"cached"`
+	Timestamp     time.Time         `json:"timestamp"`
 }
 
 type BatchRequest struct {
-	Domains []string `json:"domains"`
+	Domains          []string    `json:"domains"`
+	Items            []BatchItem `json:"items,omitempty"` // analyzed after Domains
+	Type             string      `json:"type,omitempty"`  // default kind for Domains
+	FollowSubdomains bool        `json:"follow_subdomains,omitempty"`
+	CheckSellers     bool        `json:"check_sellers,omitempty"`
+	SupplyChain      bool        `json:"supply_chain,omitempty"`
+	Group            string      `json:"group,omitempty"` // raw | registrable | alias
+}
+
+// BatchItem is a batch entry with its own file kind.
+type BatchItem struct {
+	Domain string `json:"domain"`
+	Type   string `json:"type,omitempty"` // ads | app-ads; empty => BatchRequest.Type
 }
 
 type BatchResponse struct {
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// SChainNode is one node of an OpenRTB SupplyChain object (source.ext.schain).
+type SChainNode struct {
+	ASI    string `json:"asi"`
+	SID    string `json:"sid"`
+	HP     int    `json:"hp,omitempty"`
+	RID    string `json:"rid,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// SChain is the OpenRTB SupplyChain object.
+type SChain struct {
+	Complete int          `json:"complete"`
+	Ver      string       `json:"ver,omitempty"`
+	Nodes    []SChainNode `json:"nodes"`
+}
+
+// SChainValidateRequest is the body of POST /api/schain/validate.
+type SChainValidateRequest struct {
+	Domain string `json:"domain"`         // publisher whose ads.txt authorizes the first node
+	Type   string `json:"type,omitempty"` // ads | app-ads
+	SChain SChain `json:"schain"`
+}
+
+// ads.txt verdicts for the first schain node.
+const (
+	SChainAdsTxtMatched     = "matched"
+	SChainAdsTxtMissing     = "missing"
+	SChainAdsTxtUnavailable = "unavailable"
+)
+
+// SChainNodeVerdict is the validation result of one schain node. AdsTxt is
+// only set for the first node; Sellers uses the Sellers* check statuses.
+type SChainNodeVerdict struct {
+	Index        int    `json:"index"`
+	ASI          string `json:"asi"`
+	SID          string `json:"sid"`
+	Valid        bool   `json:"valid"`
+	AdsTxt       string `json:"ads_txt,omitempty"`
+	Relationship string `json:"relationship,omitempty"` // from the matching ads.txt record
+	Sellers      string `json:"sellers"`
+	SellerType   string `json:"seller_type,omitempty"`
+	SellerName   string `json:"seller_name,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type SChainReport struct {
+	Domain    string              `json:"domain"`
+	Complete  bool                `json:"complete"`
+	Valid     bool                `json:"valid"` // every node valid
+	Nodes     []SChainNodeVerdict `json:"nodes"`
+	Timestamp time.Time           `json:"timestamp"`
+}
@@ -0,0 +1,113 @@
+package models
+
+import "time"
+
+// Seller types defined by the IAB sellers.json spec.
+const (
+	SellerTypePublisher    = "PUBLISHER"
+	SellerTypeIntermediary = "INTERMEDIARY"
+	SellerTypeBoth         = "BOTH"
+)
+
+// Seller is one entry of a sellers.json "sellers" array.
+type Seller struct {
+	SellerID       string `json:"seller_id"`
+	Name           string `json:"name,omitempty"`
+	Domain         string `json:"domain,omitempty"`
+	SellerType     string `json:"seller_type"`
+	IsConfidential bool   `json:"is_confidential,omitempty"`
+	IsPassthrough  bool   `json:"is_passthrough,omitempty"`
+	Comment        string `json:"comment,omitempty"`
+}
+
+// SellersJSON is a parsed sellers.json file.
+type SellersJSON struct {
+	Domain         string   `json:"domain"` // ad system the file was fetched from
+	ContactEmail   string   `json:"contact_email,omitempty"`
+	ContactAddress string   `json:"contact_address,omitempty"`
+	Version        string   `json:"version,omitempty"`
+	Sellers        []Seller `json:"sellers"`
+}
+
+// Sellers cross-check statuses.
+const (
+	SellersMatched         = "matched"
+	SellersMissingSellerID = "missing_seller_id"
+	SellersTypeMismatch    = "type_mismatch"
+	SellersUnavailable     = "sellers_unavailable"
+)
+
+// SellersCheckEntry is the verdict for one DIRECT/RESELLER ads.txt record.
+type SellersCheckEntry struct {
+	Line         int    `json:"line"`
+	Domain       string `json:"domain"`
+	AccountID    string `json:"account_id"`
+	Relationship string `json:"relationship"`
+	Status       string `json:"status"`
+	SellerType   string `json:"seller_type,omitempty"`
+	SellerName   string `json:"seller_name,omitempty"`
+	Error        string `json:"error,omitempty"` // why sellers.json was unavailable
+}
+
+type SellersCheckSummary struct {
+	Checked         int `json:"checked"`
+	Matched         int `json:"matched"`
+	MissingSellerID int `json:"missing_seller_id"`
+	TypeMismatch    int `json:"type_mismatch"`
+	Unavailable     int `json:"sellers_unavailable"`
+}
+
+// SellersCheck cross-validates ads.txt records against each ad system's sellers.json.
+type SellersCheck struct {
+	Summary SellersCheckSummary `json:"summary"`
+	Entries []SellersCheckEntry `json:"entries"`
+}
+
+// SellersStats summarizes an ad system's sellers.json.
+type SellersStats struct {
+	Domain             string         `json:"domain"`
+	DomainUnicode      string         `json:"domain_unicode"`
+	Version            string         `json:"version,omitempty"`
+	ContactEmail       string         `json:"contact_email,omitempty"`
+	TotalSellers       int            `json:"total_sellers"`
+	ByType             map[string]int `json:"by_type"` // seller_type -> count; "" for missing
+	Confidential       int            `json:"confidential"`
+	Passthrough        int            `json:"passthrough"`
+	DuplicateSellerIDs []string       `json:"duplicate_seller_ids"`
+	SellerDomains      []string       `json:"seller_domains"` // distinct, sorted
+	Cached             bool           `json:"cached"`
+	Timestamp          time.Time      `json:"timestamp"`
+}
+
+// Supply-chain node statuses.
+const (
+	SupplyNodeOK          = "ok"
+	SupplyNodeUnavailable = "unavailable"
+)
+
+// SupplyNode is an ad system whose sellers.json was visited.
+type SupplyNode struct {
+	Domain  string `json:"domain"`
+	Depth   int    `json:"depth"` // 0 => ad system named in ads.txt
+	Status  string `json:"status"`
+	Sellers int    `json:"sellers,omitempty"` // entries in its sellers.json
+	Error   string `json:"error,omitempty"`
+}
+
+// SupplyEdge links an ad system to an intermediary listed in its sellers.json.
+type SupplyEdge struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	SellerID   string `json:"seller_id"`
+	SellerType string `json:"seller_type"`
+	Cycle      bool   `json:"cycle,omitempty"` // To is already an ancestor of From
+}
+
+// SupplyGraph is the sellers.json graph reachable from an ads.txt's RESELLER lines.
+type SupplyGraph struct {
+	Nodes     []SupplyNode `json:"nodes"`
+	Edges     []SupplyEdge `json:"edges"`
+	MaxDepth  int          `json:"max_depth"`
+	Cycles    int          `json:"cycles"`
+	Truncated bool         `json:"truncated"` // depth or node cap reached
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/avivbaron/ads-analyzer/internal/util"
+)
+
+// OutboundOptions bounds the load the fetcher puts on origins. Zero values
+// disable the corresponding limit.
+type OutboundOptions struct {
+	PerHost     int // concurrent requests per host
+	DomainRPS   int // request starts per second per registrable domain (eTLD+1)
+	DomainBurst int // token bucket size for DomainRPS; < DomainRPS => DomainRPS
+	Global      int // concurrent requests overall
+}
+
+// Outbound is a politeness limiter for outgoing requests. Unlike Limiter's
+// Allow, Acquire waits for capacity until the context is done.
+type Outbound struct {
+	perHost int
+	domain  *Limiter      // nil => no per-domain rate
+	global  chan struct{} // nil => no global cap
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	sem   chan struct{}
+	users int // holders and waiters; the entry is dropped at zero
+}
+
+func NewOutbound(opt OutboundOptions) *Outbound {
+	o := &Outbound{perHost: opt.PerHost, hosts: make(map[string]*hostSlots)}
+	if opt.DomainRPS > 0 {
+		o.domain = New(opt.DomainRPS, opt.DomainBurst)
+	}
+	if opt.Global > 0 {
+		o.global = make(chan struct{}, opt.Global)
+	}
+	return o
+}
+
+func (o *Outbound) Close() {
+	if o.domain != nil {
+		o.domain.Close()
+	}
+}
+
+// Acquire waits for a per-host slot, a per-domain token and a global slot,
+// in that order, so waiting on a busy host never holds global capacity.
+// The returned release must be called once the response has been read.
+func (o *Outbound) Acquire(ctx context.Context, host string) (release func(), err error) {
+	releaseHost, err := o.acquireHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.waitDomain(ctx, util.RegistrableDomain(host)); err != nil {
+		releaseHost()
+		return nil, err
+	}
+	if o.global != nil {
+		select {
+		case o.global <- struct{}{}:
+		case <-ctx.Done():
+			releaseHost()
+			return nil, fmt.Errorf("waiting for outbound slot: %w", ctx.Err())
+		}
+	}
+	return func() {
+		if o.global != nil {
+			<-o.global
+		}
+		releaseHost()
+	}, nil
+}
+
+func (o *Outbound) acquireHost(ctx context.Context, host string) (func(), error) {
+	if o.perHost <= 0 {
+		return func() {}, nil
+	}
+	o.mu.Lock()
+	s, ok := o.hosts[host]
+	if !ok {
+		s = &hostSlots{sem: make(chan struct{}, o.perHost)}
+		o.hosts[host] = s
+	}
+	s.users++
+	o.mu.Unlock()
+
+	done := func() {
+		o.mu.Lock()
+		if s.users--; s.users == 0 {
+			delete(o.hosts, host)
+		}
+		o.mu.Unlock()
+	}
+	select {
+	case s.sem <- struct{}{}:
+		return func() { <-s.sem; done() }, nil
+	case <-ctx.Done():
+		done()
+		return nil, fmt.Errorf("waiting for %s slot: %w", host, ctx.Err())
+	}
+}
+
+func (o *Outbound) waitDomain(ctx context.Context, domain string) error {
+	if o.domain == nil {
+		return nil
+	}
+	for {
+		ok, retry := o.domain.Allow(domain)
+		if ok {
+			return nil
+		}
+		t := time.NewTimer(retry)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("waiting for %s rate limit: %w", domain, ctx.Err())
+		}
+	}
+}
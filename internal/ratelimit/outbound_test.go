@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestOutbound_Concurrency checks the per-host and global in-flight caps.
+// PASS: never more than PerHost concurrent holders for one host, nor more
+// than Global across hosts; every caller eventually gets through.
+// FAIL: a cap is exceeded or a caller is stuck.
+func TestOutbound_Concurrency(t *testing.T) {
+	o := NewOutbound(OutboundOptions{PerHost: 2, Global: 3})
+	defer o.Close()
+
+	var perHost, global, maxHost, maxGlobal atomic.Int64
+	bump := func(v *atomic.Int64, hi *atomic.Int64) {
+		n := v.Add(1)
+		for {
+			m := hi.Load()
+			if n <= m || hi.CompareAndSwap(m, n) {
+				return
+			}
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		host := "a.example"
+		if i%2 == 1 {
+			host = "b.example"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := o.Acquire(context.Background(), host)
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			if host == "a.example" {
+				bump(&perHost, &maxHost)
+			}
+			bump(&global, &maxGlobal)
+			time.Sleep(5 * time.Millisecond)
+			global.Add(-1)
+			if host == "a.example" {
+				perHost.Add(-1)
+			}
+			release()
+		}()
+	}
+	wg.Wait()
+	if maxHost.Load() > 2 || maxGlobal.Load() > 3 {
+		t.Fatalf("caps exceeded: per-host %d, global %d", maxHost.Load(), maxGlobal.Load())
+	}
+	if len(o.hosts) != 0 {
+		t.Fatalf("host slots leaked: %d", len(o.hosts))
+	}
+}
+
+// TestOutbound_WaitsWithContext checks that a full host and an exhausted
+// domain rate make callers wait and that cancellation ends the wait.
+// PASS: waits fail with context.DeadlineExceeded; the RPS-limited third
+// call succeeds only after a refill delay.
+// FAIL: a caller is admitted over a limit or ignores its context.
+func TestOutbound_WaitsWithContext(t *testing.T) {
+	o := NewOutbound(OutboundOptions{PerHost: 1})
+	release, err := o.Acquire(context.Background(), "a.example")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := o.Acquire(ctx, "a.example"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded while host is busy, got %v", err)
+	}
+	release()
+	o.Close()
+
+	// 10 rps (burst 10), shared by hosts of the same eTLD+1
+	o = NewOutbound(OutboundOptions{DomainRPS: 10})
+	defer o.Close()
+	hosts := []string{"a.example.com", "b.example.com", "example.com"}
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		release, err := o.Acquire(context.Background(), hosts[i%len(hosts)])
+		if err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+		release()
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("11th request was not rate limited (took %v)", d)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := o.Acquire(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded while rate limited, got %v", err)
+	}
+}
@@ -1,6 +1,10 @@
 package util
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+)
 
 // TestNormalizeDomain validates normalization from various URL-like inputs
 // to a bare host and errors on invalid inputs.
@@ -30,3 +34,105 @@ func TestNormalizeDomain(t *testing.T) {
 		t.Fatalf("want error for bad url")
 	}
 }
+
+// TestRegistrableDomain checks eTLD+1 extraction against the public suffix list.
+// PASS: each host maps to its registrable domain.
+// FAIL: any mismatch.
+func TestRegistrableDomain(t *testing.T) {
+	cases := []struct{ in, out string }{
+		{"ads.google.com", "google.com"},
+		{"google.com", "google.com"},
+		{"x.y.bbc.co.uk", "bbc.co.uk"},
+		{"Sub.Example.COM.", "example.com"},
+		{"co.uk", "co.uk"},
+	}
+	for _, c := range cases {
+		if got := RegistrableDomain(c.in); got != c.out {
+			t.Fatalf("%q -> %q want %q", c.in, got, c.out)
+		}
+	}
+}
+
+// TestWWWVariant checks the www spelling of registrable domains.
+// PASS: eTLD+1 and www.<eTLD+1> map to each other; subdomains and public
+// suffixes have no variant; StripWWW only strips www.<eTLD+1>.
+// FAIL: a variant is missing, extra, or wrong.
+func TestWWWVariant(t *testing.T) {
+	cases := []struct {
+		in, variant, stripped string
+	}{
+		{"example.com", "www.example.com", "example.com"},
+		{"www.example.com", "example.com", "example.com"},
+		{"bbc.co.uk", "www.bbc.co.uk", "bbc.co.uk"},
+		{"www.bbc.co.uk", "bbc.co.uk", "bbc.co.uk"},
+		{"news.example.com", "", "news.example.com"},
+		{"www.news.example.com", "", "www.news.example.com"},
+		{"www.com", "www.www.com", "www.com"},
+		{"co.uk", "", "co.uk"},
+	}
+	for _, c := range cases {
+		v, ok := WWWVariant(c.in)
+		if v != c.variant || ok != (c.variant != "") {
+			t.Errorf("WWWVariant(%q) = %q, %v; want %q", c.in, v, ok, c.variant)
+		}
+		if got := StripWWW(c.in); got != c.stripped {
+			t.Errorf("StripWWW(%q) = %q; want %q", c.in, got, c.stripped)
+		}
+	}
+}
+
+// TestNormalizeDomain_IDN checks that Unicode and punycode inputs normalize
+// to the same ASCII host and that invalid labels are rejected.
+// PASS: both spellings of bücher.de yield xn--bcher-kva.de; ToUnicode reverses it;
+// "a--b.com" and an empty label fail.
+// FAIL: differing keys or missing error.
+func TestNormalizeDomain_IDN(t *testing.T) {
+	for _, in := range []string{"Bücher.de", "https://bücher.de/ads.txt", "XN--BCHER-KVA.DE"} {
+		got, err := NormalizeDomain(in)
+		if err != nil || got != "xn--bcher-kva.de" {
+			t.Fatalf("%q -> %q, %v", in, got, err)
+		}
+	}
+	if u := ToUnicode("xn--bcher-kva.de"); u != "bücher.de" {
+		t.Fatalf("unicode form %q", u)
+	}
+	if u := ToUnicode("msn.com"); u != "msn.com" {
+		t.Fatalf("ascii host changed: %q", u)
+	}
+	for _, bad := range []string{"ab--cd.com", "a..b.com", "xn--zz.com"} {
+		if _, err := ToASCII(bad); err == nil {
+			t.Fatalf("want error for %q", bad)
+		}
+	}
+}
+
+// TestNormalizeDomain_Strict checks that non-public targets are rejected with
+// the expected reason and that errors still match ErrBadDomain.
+// PASS: every input fails with its reason.
+// FAIL: input accepted or wrong reason.
+func TestNormalizeDomain_Strict(t *testing.T) {
+	cases := []struct{ in, reason string }{
+		{"", ReasonEmpty},
+		{"http://", ReasonMalformed},
+		{"127.0.0.1", ReasonIPLiteral},
+		{"http://[::1]:8080/", ReasonIPLiteral},
+		{"10.1", ReasonIPLiteral},
+		{"localhost", ReasonSingleLabel},
+		{"printer.local", ReasonReservedTLD},
+		{"svc.internal", ReasonReservedTLD},
+		{"foo.test", ReasonReservedTLD},
+		{"https://user:pw@msn.com/", ReasonUserInfo},
+		{"my_site.com", ReasonInvalidChar},
+		{"a..b.com", ReasonEmptyLabel},
+		{strings.Repeat("a", 64) + ".com", ReasonLabelTooLong},
+		{strings.Repeat("abcdefghi.", 26) + "com", ReasonNameTooLong},
+		{"ab--cd.com", ReasonInvalidIDN},
+	}
+	for _, c := range cases {
+		_, err := NormalizeDomain(c.in)
+		var de *DomainError
+		if !errors.As(err, &de) || de.Reason != c.reason || !errors.Is(err, ErrBadDomain) {
+			t.Fatalf("%q: got %v want reason %s", c.in, err, c.reason)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile maps and validates labels the way browsers look hosts up
+// (UTS #46, non-transitional) but tolerates '_' and other non-LDH ASCII
+// that shows up in real ads.txt seller domains.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// ToASCII returns the canonical lower-case punycode form of host
+// ("Bücher.de" -> "xn--bcher-kva.de"). Labels that break IDNA rules
+// or DNS length limits yield a *DomainError. IP literals are returned
+// unchanged.
+func ToASCII(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return host, nil
+	}
+	a, err := idnaProfile.ToASCII(host)
+	if err != nil {
+		return "", &DomainError{Reason: ReasonInvalidIDN}
+	}
+	if err := checkLengths(a); err != nil {
+		return "", err
+	}
+	return a, nil
+}
+
+// ToUnicode returns the Unicode form of an ASCII host
+// ("xn--bcher-kva.de" -> "bücher.de"), or host itself when it has no
+// punycode labels or they cannot be decoded.
+func ToUnicode(host string) string {
+	if !strings.Contains(host, "xn--") {
+		return host
+	}
+	u, err := idnaProfile.ToUnicode(host)
+	if err != nil {
+		return host
+	}
+	return u
+}
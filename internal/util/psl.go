@@ -0,0 +1,44 @@
+package util
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// RegistrableDomain returns the eTLD+1 of host per the embedded Public
+// Suffix List ("ads.google.com" -> "google.com", "a.b.co.uk" -> "b.co.uk").
+// Hosts that are themselves a public suffix are returned unchanged.
+func RegistrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	d, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return d
+}
+
+// WWWVariant returns the other spelling of a registrable domain: "www."
+// added to a bare eTLD+1 ("example.com" -> "www.example.com") or stripped
+// from www.<eTLD+1>. Deeper subdomains and public suffixes have none.
+func WWWVariant(host string) (string, bool) {
+	d, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return "", false
+	}
+	switch host {
+	case d:
+		return "www." + d, true
+	case "www." + d:
+		return d, true
+	}
+	return "", false
+}
+
+// StripWWW returns the bare eTLD+1 for www.<eTLD+1> and host otherwise.
+func StripWWW(host string) string {
+	if v, ok := WWWVariant(host); ok && "www."+v == host {
+		return v
+	}
+	return host
+}
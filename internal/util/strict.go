@@ -0,0 +1,106 @@
+package util
+
+import (
+	"net"
+	"strings"
+)
+
+// Rejection reasons carried by DomainError. They are part of the API
+// contract, so never rename an existing reason.
+const (
+	ReasonEmpty        = "empty"
+	ReasonMalformed    = "malformed"
+	ReasonUserInfo     = "userinfo"
+	ReasonIPLiteral    = "ip_literal"
+	ReasonInvalidChar  = "invalid_character"
+	ReasonInvalidIDN   = "invalid_idn"
+	ReasonEmptyLabel   = "empty_label"
+	ReasonLabelTooLong = "label_too_long"
+	ReasonNameTooLong  = "name_too_long"
+	ReasonSingleLabel  = "single_label"
+	ReasonReservedTLD  = "reserved_tld"
+)
+
+// DNS length limits (RFC 1035), in ASCII octets without the trailing dot.
+const (
+	maxLabelLen = 63
+	maxNameLen  = 253
+)
+
+// DomainError explains why a domain was rejected. It wraps ErrBadDomain,
+// so errors.Is(err, ErrBadDomain) keeps working.
+type DomainError struct {
+	Reason string
+}
+
+func (e *DomainError) Error() string { return "invalid domain: " + e.Reason }
+func (e *DomainError) Unwrap() error { return ErrBadDomain }
+
+// reservedTLDs never resolve on the public internet (RFC 2606, 6761, 6762,
+// 9476) or are commonly used for private networks.
+var reservedTLDs = map[string]bool{
+	"alt":       true,
+	"arpa":      true,
+	"example":   true,
+	"internal":  true,
+	"invalid":   true,
+	"local":     true,
+	"localhost": true,
+	"onion":     true,
+	"test":      true,
+}
+
+// strictHost accepts only public multi-label domain names and returns their
+// ASCII form: no IP literals, no characters outside letters, digits, '-' and
+// '.', DNS length limits and no reserved TLDs.
+func strictHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", &DomainError{Reason: ReasonEmpty}
+	}
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return "", &DomainError{Reason: ReasonIPLiteral}
+	}
+	for i := 0; i < len(host); i++ {
+		c := host[i]
+		if c < 0x80 && !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return "", &DomainError{Reason: ReasonInvalidChar}
+		}
+	}
+	a, err := ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	labels := strings.Split(a, ".")
+	if len(labels) < 2 {
+		return "", &DomainError{Reason: ReasonSingleLabel}
+	}
+	tld := labels[len(labels)-1]
+	if reservedTLDs[tld] {
+		return "", &DomainError{Reason: ReasonReservedTLD}
+	}
+	if strings.Trim(tld, "0123456789") == "" {
+		// "10.1" and friends are parsed as IPv4 by resolvers
+		return "", &DomainError{Reason: ReasonIPLiteral}
+	}
+	return a, nil
+}
+
+// checkLengths enforces the DNS limits on an ASCII name.
+func checkLengths(a string) error {
+	if a == "" {
+		return &DomainError{Reason: ReasonEmpty}
+	}
+	if len(a) > maxNameLen {
+		return &DomainError{Reason: ReasonNameTooLong}
+	}
+	for _, l := range strings.Split(a, ".") {
+		switch {
+		case l == "":
+			return &DomainError{Reason: ReasonEmptyLabel}
+		case len(l) > maxLabelLen:
+			return &DomainError{Reason: ReasonLabelTooLong}
+		}
+	}
+	return nil
+}